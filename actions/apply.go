@@ -0,0 +1,385 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+	"github.com/ghodss/yaml"
+)
+
+// A Manifest declares which deployments should exist on which remotes.
+type Manifest struct {
+	Remotes []ManifestRemote `json:"remotes"`
+}
+
+// A ManifestRemote lists the deployments for a single remote, chosen by Name,
+// or for every remote matching a label Selector.
+type ManifestRemote struct {
+	Name        string               `json:"name"`
+	Selector    string               `json:"selector"`
+	Deployments []ManifestDeployment `json:"deployments"`
+}
+
+// A ManifestDeployment is a template to deploy under a given name, with an
+// optional override template. Paths are relative to the manifest.
+type ManifestDeployment struct {
+	Name     string `json:"name"`
+	Template string `json:"template"`
+	Override string `json:"override"`
+}
+
+// ApplyOptions controls what Apply is allowed to do.
+type ApplyOptions struct {
+	// Prune deletes deployments that aren't declared in the manifest from the
+	// remotes that it mentions.
+	Prune bool
+	// Yes carries out the plan. Without it, the plan is only displayed.
+	Yes bool
+}
+
+const (
+	planCreate    = "create"
+	planUpdate    = "update"
+	planDelete    = "delete"
+	planUnchanged = "unchanged"
+)
+
+// A planStep is a single change needed to bring a remote in line with the
+// manifest.
+type planStep struct {
+	Remote   config.Remote
+	Name     string
+	Action   string
+	Reason   string
+	Existing *agent.DeploymentResponseLite
+	Desired  *desiredDeployment
+}
+
+type desiredDeployment struct {
+	Source    templateSource
+	Blueprint agent.DeploymentBlueprint
+}
+
+// Apply compares the deployments declared in the manifest at path with those
+// on each remote, and displays the plan for reconciling them. The plan is
+// only carried out when opts.Yes is set.
+func Apply(c config.Config, path string, opts ApplyOptions) (prettycli.Output, error) {
+	remotes, desired, err := loadManifest(c, path)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	plan, err := planApply(remotes, desired, opts.Prune)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	changes := 0
+	for _, s := range plan {
+		if s.Action != planUnchanged {
+			changes++
+		}
+	}
+
+	po := prettycli.ListOutput{Labels: []string{"Remote", "Deployment", "Action", "Reason"}}
+	for _, s := range plan {
+		po.AddRow(map[string]string{
+			"Remote":     s.Remote.Name,
+			"Deployment": s.Name,
+			"Action":     s.Action,
+			"Reason":     s.Reason,
+		})
+	}
+
+	co := prettycli.CombinedOutput{}
+	co.AddOutput("Plan", po)
+	if changes == 0 {
+		co.AddOutput("", prettycli.PlainOutput{"Everything is up to date."})
+		return &co, nil
+	}
+	if !opts.Yes {
+		co.AddOutput("", prettycli.PlainOutput{fmt.Sprintf("%d change(s) planned. Run again with --yes to apply them.", changes)})
+		return &co, nil
+	}
+
+	ro, err := executePlan(remotes, plan)
+	co.AddOutput("Results", ro)
+	return &co, err
+}
+
+func loadManifest(c config.Config, path string) ([]config.Remote, map[string][]ManifestDeployment, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var m Manifest
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, nil, err
+	}
+
+	dir := filepath.Dir(path)
+	var remotes []config.Remote
+	seen := make(map[string]bool)
+	desired := make(map[string][]ManifestDeployment)
+	for _, mr := range m.Remotes {
+		var targets []config.Remote
+		switch {
+		case mr.Name != "" && mr.Selector != "":
+			return nil, nil, errors.New("manifest remotes must have either a name or a selector, not both")
+		case mr.Name != "":
+			r, err := c.Get(mr.Name)
+			if err != nil {
+				return nil, nil, err
+			}
+			targets = []config.Remote{r}
+		case mr.Selector != "":
+			selector, err := config.ParseLabels(mr.Selector)
+			if err != nil {
+				return nil, nil, err
+			}
+			targets = config.SelectRemotes(c.Remotes(), selector)
+		default:
+			return nil, nil, errors.New("manifest remotes must have a name or a selector")
+		}
+
+		for _, r := range targets {
+			if !seen[r.Name] {
+				seen[r.Name] = true
+				remotes = append(remotes, r)
+			}
+			for _, md := range mr.Deployments {
+				if md.Template == "" {
+					return nil, nil, fmt.Errorf("deployment '%s' has no template", md.Name)
+				}
+				md.Template = relativeTo(dir, md.Template)
+				if md.Override != "" {
+					md.Override = relativeTo(dir, md.Override)
+				}
+				desired[r.Name] = append(desired[r.Name], md)
+			}
+		}
+	}
+
+	return remotes, desired, nil
+}
+
+func relativeTo(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func loadDesiredDeployment(md ManifestDeployment) (desiredDeployment, error) {
+	d := desiredDeployment{Source: templateSource{Path: md.Template, OverridePath: md.Override}}
+	var err error
+	if d.Source.Template, err = readTemplateFile(md.Template); err != nil {
+		return d, err
+	}
+	if md.Override != "" {
+		if d.Source.Override, err = readTemplateFile(md.Override); err != nil {
+			return d, err
+		}
+	}
+	if d.Blueprint, err = d.Source.blueprint(); err != nil {
+		return d, err
+	}
+	if md.Name != "" {
+		d.Blueprint.Template.Name = md.Name
+	}
+
+	return d, nil
+}
+
+func planApply(remotes []config.Remote, desired map[string][]ManifestDeployment, prune bool) ([]planStep, error) {
+	results := fanOut(remotes, 0, 0, func(r config.Remote) (interface{}, error) {
+		return DefaultAgentClientFactory.New(r).ListDeployments()
+	})
+
+	var entries []config.JournalEntry
+	if DefaultJournal != nil {
+		var err error
+		if entries, err = DefaultJournal.Entries(); err != nil {
+			return nil, err
+		}
+	}
+
+	var plan []planStep
+	for _, res := range results {
+		if res.Err != nil {
+			return nil, fmt.Errorf("could not list the deployments on '%s': %s", res.Remote.Name, res.Err)
+		}
+
+		existing := make(map[string]agent.DeploymentResponseLite)
+		var extras []agent.DeploymentResponseLite
+		for _, d := range res.Value.([]agent.DeploymentResponseLite) {
+			if _, ok := existing[d.Name]; ok {
+				extras = append(extras, d)
+				continue
+			}
+			existing[d.Name] = d
+		}
+
+		declared := make(map[string]bool)
+		for _, md := range desired[res.Remote.Name] {
+			d, err := loadDesiredDeployment(md)
+			if err != nil {
+				return nil, err
+			}
+
+			name := d.Blueprint.Template.Name
+			if declared[name] {
+				return nil, fmt.Errorf("deployment '%s' is declared more than once for '%s'", name, res.Remote.Name)
+			}
+			declared[name] = true
+
+			step := planStep{Remote: res.Remote, Name: name, Desired: &d}
+			if e, ok := existing[name]; !ok {
+				step.Action, step.Reason = planCreate, "not deployed"
+			} else {
+				step.Existing = &e
+				step.Action, step.Reason = compareWithJournal(entries, res.Remote, e, d)
+			}
+			plan = append(plan, step)
+		}
+
+		if !prune {
+			continue
+		}
+		for _, d := range res.Value.([]agent.DeploymentResponseLite) {
+			isExtra := false
+			for _, e := range extras {
+				isExtra = isExtra || e.ID == d.ID
+			}
+			if declared[d.Name] && !isExtra {
+				continue
+			}
+
+			d := d
+			reason := "not declared"
+			if isExtra {
+				reason = "duplicate name"
+			}
+			plan = append(plan, planStep{Remote: res.Remote, Name: d.Name, Action: planDelete, Reason: reason, Existing: &d})
+		}
+	}
+
+	return plan, nil
+}
+
+// compareWithJournal decides whether an existing deployment matches the
+// desired one, based on the template and override template the journal says
+// it was created from.
+func compareWithJournal(entries []config.JournalEntry, r config.Remote, existing agent.DeploymentResponseLite, d desiredDeployment) (string, string) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.Remote != r.Name || e.DeploymentID != existing.ID || e.TemplateHash == "" {
+			continue
+		}
+
+		if e.TemplateHash != config.TemplateHash(d.Source.Template) {
+			return planUpdate, "template changed"
+		}
+		overrideHash := ""
+		if d.Source.Override != nil {
+			overrideHash = config.TemplateHash(d.Source.Override)
+		}
+		if e.OverrideHash != overrideHash {
+			return planUpdate, "overrides changed"
+		}
+		return planUnchanged, ""
+	}
+
+	return planUpdate, "no local record of its template"
+}
+
+func executePlan(remotes []config.Remote, plan []planStep) (prettycli.Output, error) {
+	// Each remote's steps run in order, but remotes are handled concurrently.
+	results := fanOut(remotes, 0, 0, func(r config.Remote) (interface{}, error) {
+		outcomes := make(map[int]string)
+		for i, s := range plan {
+			if s.Remote.Name != r.Name || s.Action == planUnchanged {
+				continue
+			}
+			outcome, err := executeStep(s)
+			if err != nil {
+				outcome = fmt.Sprintf("failed: %s", err)
+			}
+			outcomes[i] = outcome
+		}
+		return outcomes, nil
+	})
+
+	outcomes := make(map[int]string)
+	for _, res := range results {
+		for i, o := range res.Value.(map[int]string) {
+			outcomes[i] = o
+		}
+	}
+
+	lo := prettycli.ListOutput{Labels: []string{"Remote", "Deployment", "Action", "Result"}}
+	failures := 0
+	for i, s := range plan {
+		outcome, ok := outcomes[i]
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(outcome, "failed: ") {
+			failures++
+		}
+		lo.AddRow(map[string]string{
+			"Remote":     s.Remote.Name,
+			"Deployment": s.Name,
+			"Action":     s.Action,
+			"Result":     outcome,
+		})
+	}
+
+	if failures > 0 {
+		return &lo, fmt.Errorf("%d change(s) could not be applied", failures)
+	}
+	return &lo, nil
+}
+
+// executeStep carries out a single step of the plan. Since the agent can only
+// redeploy a deployment's original template, updates create a replacement and
+// then delete the existing deployment, as UpgradeDeployment does with
+// CreateFirst, so that a replacement that fails leaves the existing one
+// running.
+func executeStep(s planStep) (string, error) {
+	c := DefaultAgentClientFactory.New(s.Remote)
+	deleteExisting := func() error {
+		if err := c.DeleteDeployment(strconv.Itoa(s.Existing.ID)); err != nil {
+			return err
+		}
+		recordDelete(s.Remote, s.Existing.ID)
+		return nil
+	}
+
+	if s.Action == planDelete {
+		if err := deleteExisting(); err != nil {
+			return "", err
+		}
+		return "deleted", nil
+	}
+
+	dr, err := deployBlueprint(s.Remote, s.Desired.Blueprint, s.Desired.Source)
+	if err != nil {
+		return "", err
+	}
+	if s.Existing == nil {
+		return fmt.Sprintf("deployed as '%d'", dr.ID), nil
+	}
+	if err := deleteExisting(); err != nil {
+		return "", fmt.Errorf("deployed as '%d', but the existing deployment '%d' could not be deleted: %s", dr.ID, s.Existing.ID, err)
+	}
+	return fmt.Sprintf("deployed as '%d', replacing '%d'", dr.ID, s.Existing.ID), nil
+}
@@ -0,0 +1,247 @@
+package actions
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+	"github.com/stretchr/testify/assert"
+)
+
+var applyManifest = `
+remotes:
+- name: Prod
+  deployments:
+  - name: Wordpress
+    template: wordpress.pmx
+  - name: Redis
+    template: redis.pmx
+  - name: Cache
+    template: redis.pmx
+    override: overrides/cache.pmx
+`
+
+func setupApply(t *testing.T, manifest string) (string, *FakeClient, *FakeJournal) {
+	setupFactory()
+	dir, err := ioutil.TempDir("", "pmx-apply")
+	assert.NoError(t, err)
+	os.Mkdir(filepath.Join(dir, "overrides"), 0700)
+	files := map[string]string{
+		"stack.yml":           manifest,
+		"wordpress.pmx":       wordpressTemplate,
+		"redis.pmx":           "name: Redis\nimages:\n- name: redis\n  source: redis:3\n",
+		"overrides/cache.pmx": "images:\n- name: redis\n  environment:\n  - variable: MAXMEMORY\n    value: 1gb\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	prod := &FakeClient{
+		Deployments: []agent.DeploymentResponseLite{
+			{ID: 1, Name: "Wordpress"},
+			{ID: 2, Name: "Old"},
+			{ID: 3, Name: "Redis"},
+		},
+		DeployedDeployment: agent.DeploymentResponseLite{ID: 10},
+	}
+	fakeFactory.Clients = map[string]*FakeClient{"Prod": prod}
+
+	j := setupJournal()
+	j.Record(config.JournalEntry{Remote: "Prod", DeploymentID: 1}, []byte(wordpressTemplate), nil)
+	j.Record(config.JournalEntry{Remote: "Prod", DeploymentID: 3}, []byte("name: Redis\n"), nil)
+
+	return dir, prod, j
+}
+
+func applyConfig() *FakeConfig {
+	return &FakeConfig{Agents: []config.Remote{
+		{Name: "Prod", Labels: config.Labels{"env": "prod"}},
+		{Name: "Staging", Labels: config.Labels{"env": "staging"}},
+	}}
+}
+
+func planRows(t *testing.T, o prettycli.Output) ([]map[string]string, *prettycli.CombinedOutput) {
+	co, ok := o.(*prettycli.CombinedOutput)
+	if !assert.True(t, ok) || !assert.True(t, len(co.Outputs) > 1) {
+		return nil, nil
+	}
+	lo, ok := co.Outputs[0].Output.(prettycli.ListOutput)
+	if !assert.True(t, ok) {
+		return nil, nil
+	}
+	return lo.Rows, co
+}
+
+func TestApplyPlan(t *testing.T) {
+	dir, prod, _ := setupApply(t, applyManifest)
+	defer os.RemoveAll(dir)
+
+	o, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{Prune: true})
+	assert.NoError(t, err)
+
+	rows, co := planRows(t, o)
+	if assert.Len(t, rows, 4) {
+		assert.Equal(t, map[string]string{"Remote": "Prod", "Deployment": "Wordpress", "Action": "unchanged", "Reason": ""}, rows[0])
+		assert.Equal(t, "update", rows[1]["Action"])
+		assert.Equal(t, "template changed", rows[1]["Reason"])
+		assert.Equal(t, "Cache", rows[2]["Deployment"])
+		assert.Equal(t, "create", rows[2]["Action"])
+		assert.Equal(t, "Old", rows[3]["Deployment"])
+		assert.Equal(t, "delete", rows[3]["Action"])
+		assert.Equal(t, "not declared", rows[3]["Reason"])
+	}
+	assert.Equal(t, "3 change(s) planned. Run again with --yes to apply them.", co.Outputs[1].Output.ToPrettyOutput())
+
+	assert.Empty(t, prod.DeletedDeployment)
+	assert.Empty(t, prod.DeployedBlueprint.Template.Name)
+}
+
+func TestApplyWithoutPrune(t *testing.T) {
+	dir, _, _ := setupApply(t, applyManifest)
+	defer os.RemoveAll(dir)
+
+	o, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{})
+	assert.NoError(t, err)
+	rows, _ := planRows(t, o)
+	assert.Len(t, rows, 3)
+}
+
+func TestApplyYes(t *testing.T) {
+	dir, prod, j := setupApply(t, applyManifest)
+	defer os.RemoveAll(dir)
+	manifest := "remotes:\n- selector: env=prod\n  deployments:\n  - name: Cache\n    template: redis.pmx\n    override: overrides/cache.pmx\n  - name: Redis\n    template: redis.pmx\n"
+	ioutil.WriteFile(filepath.Join(dir, "stack.yml"), []byte(manifest), 0600)
+
+	o, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{Yes: true})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "3", prod.DeletedDeployment)
+	assert.Equal(t, "Redis", prod.DeployedBlueprint.Template.Name)
+
+	co, ok := o.(*prettycli.CombinedOutput)
+	if assert.True(t, ok) && assert.Len(t, co.Outputs, 2) {
+		assert.Equal(t, "Results", co.Outputs[1].Heading)
+		lo := co.Outputs[1].Output.(*prettycli.ListOutput)
+		if assert.Len(t, lo.Rows, 2) {
+			assert.Equal(t, "Cache", lo.Rows[0]["Deployment"])
+			assert.Equal(t, "create", lo.Rows[0]["Action"])
+			assert.Equal(t, "deployed as '10'", lo.Rows[0]["Result"])
+			assert.Equal(t, "update", lo.Rows[1]["Action"])
+			assert.Equal(t, "deployed as '10', replacing '3'", lo.Rows[1]["Result"])
+		}
+	}
+
+	if assert.Len(t, j.Recorded, 5) {
+		assert.Equal(t, "Cache", j.Recorded[2].Name)
+		assert.Equal(t, filepath.Join(dir, "redis.pmx"), j.Recorded[2].TemplatePath)
+		assert.Equal(t, "create", j.Recorded[3].Action)
+		assert.Equal(t, "delete", j.Recorded[4].Action)
+		assert.Equal(t, 3, j.Recorded[4].DeploymentID)
+	}
+}
+
+func TestErroredCreateApplyYes(t *testing.T) {
+	dir, prod, j := setupApply(t, "remotes:\n- name: Prod\n  deployments:\n  - name: Redis\n    template: redis.pmx\n")
+	defer os.RemoveAll(dir)
+	prod.ErrorForDeploymentCreate = errors.New("test error")
+
+	o, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{Yes: true})
+	assert.EqualError(t, err, "1 change(s) could not be applied")
+	lo := o.(*prettycli.CombinedOutput).Outputs[1].Output.(*prettycli.ListOutput)
+	if assert.Len(t, lo.Rows, 1) {
+		assert.Equal(t, "update", lo.Rows[0]["Action"])
+		assert.Equal(t, "failed: test error", lo.Rows[0]["Result"])
+	}
+	assert.Equal(t, "", prod.DeletedDeployment)
+	assert.Len(t, j.Recorded, 2)
+}
+
+func TestErroredApplyYes(t *testing.T) {
+	dir, prod, _ := setupApply(t, applyManifest)
+	defer os.RemoveAll(dir)
+	prod.ErrorForDeploymentDelete = errors.New("test error")
+
+	o, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{Yes: true, Prune: true})
+	assert.EqualError(t, err, "2 change(s) could not be applied")
+
+	co := o.(*prettycli.CombinedOutput)
+	lo := co.Outputs[1].Output.(*prettycli.ListOutput)
+	if assert.Len(t, lo.Rows, 3) {
+		assert.Equal(t, "failed: deployed as '10', but the existing deployment '3' could not be deleted: test error", lo.Rows[0]["Result"])
+		assert.Equal(t, "deployed as '10'", lo.Rows[1]["Result"])
+	}
+}
+
+func TestUpToDateApply(t *testing.T) {
+	dir, _, _ := setupApply(t, "remotes:\n- name: Prod\n  deployments:\n  - template: wordpress.pmx\n    name: Wordpress\n")
+	defer os.RemoveAll(dir)
+
+	o, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{Yes: true})
+	assert.NoError(t, err)
+	_, co := planRows(t, o)
+	assert.Equal(t, "Everything is up to date.", co.Outputs[1].Output.ToPrettyOutput())
+}
+
+func TestChangedOverrideApply(t *testing.T) {
+	dir, prod, j := setupApply(t, applyManifest)
+	defer os.RemoveAll(dir)
+	prod.Deployments = append(prod.Deployments, agent.DeploymentResponseLite{ID: 4, Name: "Cache"})
+	j.Record(config.JournalEntry{Remote: "Prod", DeploymentID: 4}, []byte("name: Redis\nimages:\n- name: redis\n  source: redis:3\n"), []byte("images: []\n"))
+
+	o, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{})
+	assert.NoError(t, err)
+	rows, _ := planRows(t, o)
+	if assert.Len(t, rows, 3) {
+		assert.Equal(t, "Cache", rows[2]["Deployment"])
+		assert.Equal(t, "update", rows[2]["Action"])
+		assert.Equal(t, "overrides changed", rows[2]["Reason"])
+	}
+}
+
+func TestUnrecordedApply(t *testing.T) {
+	dir, _, _ := setupApply(t, "remotes:\n- name: Prod\n  deployments:\n  - template: wordpress.pmx\n    name: Wordpress\n")
+	defer os.RemoveAll(dir)
+	DefaultJournal = nil
+
+	o, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{})
+	assert.NoError(t, err)
+	rows, _ := planRows(t, o)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "update", rows[0]["Action"])
+		assert.Equal(t, "no local record of its template", rows[0]["Reason"])
+	}
+}
+
+func TestErroredManifestApply(t *testing.T) {
+	dir, _, _ := setupApply(t, "")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stack.yml")
+
+	cases := map[string]string{
+		"remotes:\n- name: Bad\n":                                  "the remote 'Bad' does not exist",
+		"remotes:\n- deployments: []\n":                            "manifest remotes must have a name or a selector",
+		"remotes:\n- name: Prod\n  selector: env=prod\n":           "manifest remotes must have either a name or a selector, not both",
+		"remotes:\n- name: Prod\n  deployments:\n  - name: Nope\n": "deployment 'Nope' has no template",
+		"remotes:\n- name: Prod\n  deployments:\n  - template: wordpress.pmx\n  - template: wordpress.pmx\n": "deployment 'Wordpress with MySQL' is declared more than once for 'Prod'",
+	}
+	for manifest, message := range cases {
+		ioutil.WriteFile(path, []byte(manifest), 0600)
+		o, err := Apply(applyConfig(), path, ApplyOptions{})
+		assert.EqualError(t, err, message)
+		assert.Equal(t, prettycli.PlainOutput{}, o)
+	}
+}
+
+func TestErroredListApply(t *testing.T) {
+	dir, prod, _ := setupApply(t, applyManifest)
+	defer os.RemoveAll(dir)
+	prod.ErrorForDeploymentList = errors.New("test error")
+
+	_, err := Apply(applyConfig(), filepath.Join(dir, "stack.yml"), ApplyOptions{})
+	assert.EqualError(t, err, "could not list the deployments on 'Prod': test error")
+}
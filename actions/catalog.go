@@ -0,0 +1,269 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/panamaxcli/template"
+	"github.com/CenturyLinkLabs/prettycli"
+)
+
+// A catalogTemplate is a template in one of the catalog's repos.
+type catalogTemplate struct {
+	Path string
+	template.Template
+}
+
+func (t catalogTemplate) matches(keyword string) bool {
+	keyword = strings.ToLower(keyword)
+	for _, s := range []string{t.Name, t.Description, t.Keywords, t.Type} {
+		if strings.Contains(strings.ToLower(s), keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTemplateRepo adds a directory of templates, such as a checkout of a Git
+// repository of templates, to the catalog.
+func AddTemplateRepo(c config.Config, path string) (prettycli.Output, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if !info.IsDir() {
+		return prettycli.PlainOutput{}, fmt.Errorf("'%s' is not a directory", path)
+	}
+
+	if err := c.AddTemplateRepo(abs); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	templates, skipped := scanTemplateRepo(abs)
+	warnSkipped(skipped)
+	return prettycli.PlainOutput{fmt.Sprintf("Added template repo '%s' with %d template(s)", abs, len(templates))}, nil
+}
+
+func ListTemplateRepos(c config.Config) prettycli.Output {
+	if len(c.TemplateRepos()) == 0 {
+		return prettycli.PlainOutput{"No template repos"}
+	}
+
+	o := prettycli.ListOutput{Labels: []string{"Path", "Templates"}}
+	for _, r := range c.TemplateRepos() {
+		templates, _ := scanTemplateRepo(r)
+		o.AddRow(map[string]string{
+			"Path":      r,
+			"Templates": strconv.Itoa(len(templates)),
+		})
+	}
+	return &o
+}
+
+func RemoveTemplateRepo(c config.Config, path string) (prettycli.Output, error) {
+	// Repos are stored with absolute paths, but allow them to be removed by
+	// either.
+	if abs, err := filepath.Abs(path); err == nil && !containsString(c.TemplateRepos(), path) {
+		path = abs
+	}
+	if err := c.RemoveTemplateRepo(path); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	return prettycli.PlainOutput{fmt.Sprintf("Removed template repo '%s'", path)}, nil
+}
+
+// SearchTemplates lists the templates in the catalog whose name, description,
+// keywords or type contain the keyword, with recommended templates first.
+func SearchTemplates(c config.Config, keyword string) (prettycli.Output, error) {
+	var found []catalogTemplate
+	templates, skipped := catalogTemplates(c)
+	warnSkipped(skipped)
+	for _, t := range templates {
+		if t.matches(keyword) {
+			found = append(found, t)
+		}
+	}
+	if len(found) == 0 {
+		return prettycli.PlainOutput{"No templates found"}, nil
+	}
+
+	sort.Stable(byRecommendation(found))
+	o := prettycli.ListOutput{Labels: []string{"Name", "Recommended", "Description", "Keywords", "Path"}}
+	for _, t := range found {
+		recommended := ""
+		if t.IsRecommended() {
+			recommended = "yes"
+		}
+		o.AddRow(map[string]string{
+			"Name":        t.Name,
+			"Recommended": recommended,
+			"Description": t.Description,
+			"Keywords":    t.Keywords,
+			"Path":        t.Path,
+		})
+	}
+	return &o, nil
+}
+
+// ShowTemplate describes the template in the catalog with the given name.
+func ShowTemplate(c config.Config, name string) (prettycli.Output, error) {
+	t, skipped, err := findCatalogTemplate(c, name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	warnSkipped(skipped)
+
+	do := prettycli.DetailOutput{
+		Details: map[string]string{
+			"Name":        t.Name,
+			"Description": t.Description,
+			"Keywords":    t.Keywords,
+			"Type":        t.Type,
+			"Recommended": strconv.FormatBool(t.IsRecommended()),
+			"Authors":     strings.Join(t.Authors, ", "),
+			"Path":        t.Path,
+		},
+		Order: []string{"Name", "Description", "Keywords", "Type", "Recommended", "Authors", "Path"},
+	}
+	lo := prettycli.ListOutput{Labels: []string{"Name", "Source", "Category", "Type", "Description"}}
+	for _, i := range t.Images {
+		lo.AddRow(map[string]string{
+			"Name":        i.Name,
+			"Source":      i.Source,
+			"Category":    i.Category,
+			"Type":        i.Type,
+			"Description": i.Description,
+		})
+	}
+
+	co := prettycli.CombinedOutput{}
+	co.AddOutput("", do)
+	co.AddOutput("Images", lo)
+	if doc := strings.TrimSpace(t.Documentation); doc != "" {
+		co.AddOutput("Documentation", prettycli.PlainOutput{doc})
+	}
+	return &co, nil
+}
+
+// ResolveTemplatePath returns ref when it's the path to a file, or otherwise
+// the path of the template in the catalog named ref.
+func ResolveTemplatePath(c config.Config, ref string) (string, error) {
+	if _, err := os.Stat(ref); err == nil {
+		return ref, nil
+	}
+
+	t, _, err := findCatalogTemplate(c, ref)
+	if err != nil {
+		return "", fmt.Errorf("'%s' is not a template file, and %s", ref, err)
+	}
+	return t.Path, nil
+}
+
+// findCatalogTemplate returns the template in the catalog with the given name,
+// and the files in the catalog that had to be skipped.
+func findCatalogTemplate(c config.Config, name string) (catalogTemplate, []string, error) {
+	var found []catalogTemplate
+	templates, skipped := catalogTemplates(c)
+	for _, t := range templates {
+		if strings.EqualFold(t.Name, name) {
+			found = append(found, t)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		if len(skipped) > 0 {
+			return catalogTemplate{}, skipped, fmt.Errorf("no template named '%s' is in the catalog, though %d file(s) in it could not be read: %s", name, len(skipped), strings.Join(skipped, "; "))
+		}
+		return catalogTemplate{}, skipped, fmt.Errorf("no template named '%s' is in the catalog", name)
+	case 1:
+		return found[0], skipped, nil
+	default:
+		var paths []string
+		for _, t := range found {
+			paths = append(paths, t.Path)
+		}
+		return catalogTemplate{}, skipped, fmt.Errorf("%d templates in the catalog are named '%s': %s", len(found), name, strings.Join(paths, ", "))
+	}
+}
+
+func catalogTemplates(c config.Config) ([]catalogTemplate, []string) {
+	var templates []catalogTemplate
+	var skipped []string
+	for _, r := range c.TemplateRepos() {
+		t, s := scanTemplateRepo(r)
+		templates = append(templates, t...)
+		skipped = append(skipped, s...)
+	}
+	return templates, skipped
+}
+
+// scanTemplateRepo reads every .pmx file in the directory and the directories
+// beneath it, except hidden ones such as ".git". Files that can't be read are
+// skipped, so one broken template doesn't hide the rest, and are returned
+// with the reason so that they can be warned about.
+func scanTemplateRepo(dir string) ([]catalogTemplate, []string) {
+	var templates []catalogTemplate
+	var skipped []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("'%s': %s", path, err))
+			return nil
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".pmx" {
+			return nil
+		}
+
+		t, err := template.Read(path)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("'%s': %s", path, err))
+			return nil
+		}
+		templates = append(templates, catalogTemplate{Path: path, Template: t})
+		return nil
+	})
+	return templates, skipped
+}
+
+// warnSkipped warns about each file in the catalog that had to be skipped.
+func warnSkipped(skipped []string) {
+	for _, s := range skipped {
+		warnf("skipped %s", s)
+	}
+}
+
+type byRecommendation []catalogTemplate
+
+func (s byRecommendation) Len() int      { return len(s) }
+func (s byRecommendation) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byRecommendation) Less(i, j int) bool {
+	if s[i].IsRecommended() != s[j].IsRecommended() {
+		return s[i].IsRecommended()
+	}
+	return strings.ToLower(s[i].Name) < strings.ToLower(s[j].Name)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
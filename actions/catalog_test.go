@@ -0,0 +1,179 @@
+package actions
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CenturyLinkLabs/prettycli"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCatalog(t *testing.T) (string, *FakeConfig) {
+	dir, err := ioutil.TempDir("", "pmx-catalog")
+	assert.NoError(t, err)
+	os.Mkdir(filepath.Join(dir, "db"), 0700)
+	os.Mkdir(filepath.Join(dir, ".git"), 0700)
+	files := map[string]string{
+		"wordpress.pmx":    wordpressTemplate,
+		"db/redis.pmx":     "name: Redis\ndescription: Key-value store\nkeywords: cache, nosql\ntype: database\nimages:\n- name: redis\n  source: redis:3\n",
+		"db/broken.pmx":    "name: [",
+		".git/ignored.pmx": "name: Ignored\n",
+		"README.md":        "name: Not a template\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+
+	return dir, &FakeConfig{Repos: []string{dir}}
+}
+
+// captureWarnings collects what's warned about until the returned function is
+// called.
+func captureWarnings() (*bytes.Buffer, func()) {
+	var b bytes.Buffer
+	Warnings = &b
+	return &b, func() { Warnings = os.Stderr }
+}
+
+func TestAddTemplateRepo(t *testing.T) {
+	dir, _ := setupCatalog(t)
+	defer os.RemoveAll(dir)
+	fc := &FakeConfig{}
+	warnings, restore := captureWarnings()
+	defer restore()
+
+	o, err := AddTemplateRepo(fc, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "Added template repo '"+dir+"' with 2 template(s)", o.ToPrettyOutput())
+	assert.Contains(t, warnings.String(), "Warning: skipped '"+filepath.Join(dir, "db/broken.pmx")+"': ")
+	assert.Equal(t, []string{dir}, fc.Repos)
+}
+
+func TestErroredAddTemplateRepo(t *testing.T) {
+	dir, _ := setupCatalog(t)
+	defer os.RemoveAll(dir)
+
+	_, err := AddTemplateRepo(&FakeConfig{}, filepath.Join(dir, "wordpress.pmx"))
+	assert.Contains(t, err.Error(), "is not a directory")
+	_, err = AddTemplateRepo(&FakeConfig{}, "/nonexistant")
+	assert.Error(t, err)
+	_, err = AddTemplateRepo(&FakeConfig{ErrorForRepo: errors.New("test error")}, dir)
+	assert.EqualError(t, err, "test error")
+}
+
+func TestListAndRemoveTemplateRepos(t *testing.T) {
+	dir, fc := setupCatalog(t)
+	defer os.RemoveAll(dir)
+
+	lo := ListTemplateRepos(fc).(*prettycli.ListOutput)
+	if assert.Len(t, lo.Rows, 1) {
+		assert.Equal(t, "2", lo.Rows[0]["Templates"])
+	}
+
+	o, err := RemoveTemplateRepo(fc, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "Removed template repo '"+dir+"'", o.ToPrettyOutput())
+	assert.Equal(t, "No template repos", ListTemplateRepos(fc).ToPrettyOutput())
+}
+
+func TestSearchTemplates(t *testing.T) {
+	dir, fc := setupCatalog(t)
+	defer os.RemoveAll(dir)
+	warnings, restore := captureWarnings()
+	defer restore()
+
+	for _, keyword := range []string{"REDIS", "key-value", "nosql", "database"} {
+		o, err := SearchTemplates(fc, keyword)
+		assert.NoError(t, err)
+		if rows := searchRows(t, o); assert.Len(t, rows, 1, keyword) {
+			assert.Equal(t, "Redis", rows[0]["Name"])
+			assert.Equal(t, filepath.Join(dir, "db/redis.pmx"), rows[0]["Path"])
+		}
+	}
+
+	o, err := SearchTemplates(fc, "")
+	assert.NoError(t, err)
+	rows := searchRows(t, o)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "Wordpress with MySQL", rows[0]["Name"])
+		assert.Equal(t, "yes", rows[0]["Recommended"])
+	}
+
+	warnings.Reset()
+	o, err = SearchTemplates(fc, "ignored")
+	assert.NoError(t, err)
+	assert.Equal(t, "No templates found", o.ToPrettyOutput())
+	assert.Contains(t, warnings.String(), "Warning: skipped '"+filepath.Join(dir, "db/broken.pmx")+"': ")
+}
+
+func TestSearchTemplatesWithoutSkipped(t *testing.T) {
+	dir, fc := setupCatalog(t)
+	defer os.RemoveAll(dir)
+	os.Remove(filepath.Join(dir, "db/broken.pmx"))
+	warnings, restore := captureWarnings()
+	defer restore()
+
+	o, err := SearchTemplates(fc, "redis")
+	assert.NoError(t, err)
+	assert.Len(t, searchRows(t, o), 1)
+	assert.Empty(t, warnings.String())
+}
+
+func searchRows(t *testing.T, o prettycli.Output) []map[string]string {
+	lo, ok := o.(*prettycli.ListOutput)
+	if !assert.True(t, ok) {
+		return nil
+	}
+	return lo.Rows
+}
+
+func TestShowTemplate(t *testing.T) {
+	dir, fc := setupCatalog(t)
+	defer os.RemoveAll(dir)
+	warnings, restore := captureWarnings()
+	defer restore()
+
+	o, err := ShowTemplate(fc, "wordpress with mysql")
+	assert.NoError(t, err)
+	s := o.ToPrettyOutput()
+	assert.Contains(t, s, "Description\tWordpress container linked to a MySQL container")
+	assert.Contains(t, s, "IMAGES\n")
+	assert.Contains(t, s, "centurylink/mysql:5.5")
+	assert.Contains(t, s, "DOCUMENTATION\nWordpress with MySQL\n====")
+	assert.NotContains(t, s, "WARNINGS")
+	assert.Contains(t, warnings.String(), "Warning: skipped '"+filepath.Join(dir, "db/broken.pmx")+"': ")
+
+	_, err = ShowTemplate(fc, "Missing")
+	assert.Contains(t, err.Error(), "no template named 'Missing' is in the catalog, though 1 file(s) in it could not be read: '"+filepath.Join(dir, "db/broken.pmx")+"': ")
+}
+
+func TestErroredDuplicateShowTemplate(t *testing.T) {
+	dir, fc := setupCatalog(t)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "redis.pmx"), []byte("name: Redis\n"), 0600)
+
+	_, err := ShowTemplate(fc, "Redis")
+	assert.Contains(t, err.Error(), "2 templates in the catalog are named 'Redis'")
+}
+
+func TestResolveTemplatePath(t *testing.T) {
+	dir, fc := setupCatalog(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "wordpress.pmx")
+
+	p, err := ResolveTemplatePath(fc, path)
+	assert.NoError(t, err)
+	assert.Equal(t, path, p)
+
+	p, err = ResolveTemplatePath(fc, "Redis")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "db/redis.pmx"), p)
+
+	os.Remove(filepath.Join(dir, "db/broken.pmx"))
+	_, err = ResolveTemplatePath(fc, "Missing")
+	assert.EqualError(t, err, "'Missing' is not a template file, and no template named 'Missing' is in the catalog")
+}
@@ -1,7 +1,13 @@
 package actions
 
 import (
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
 	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+	"github.com/CenturyLinkLabs/panamaxcli/agentclient"
 	"github.com/CenturyLinkLabs/panamaxcli/config"
 )
 
@@ -11,17 +17,101 @@ type AgentClientFactory interface {
 
 var DefaultAgentClientFactory AgentClientFactory
 
+// CommandCAFile, when set, is a PEM file of certificates that every remote is
+// trusted to present, as well as the ones in their tokens and CA bundles.
+var CommandCAFile string
+
+// CommandTimeout, when set, is used for every call to every remote instead
+// of the remotes' own timeouts and the defaults.
+var CommandTimeout time.Duration
+
 func init() {
 	DefaultAgentClientFactory = &APIClientFactory{}
 }
 
-type APIClientFactory struct{}
+// APIClientFactory makes a client for each remote the first time it's asked
+// for one, and returns the same client after that, so that polling and
+// fanning out over many remotes reuse their connections.
+type APIClientFactory struct {
+	// RoundTripper, when set, is given each remote and the transport built
+	// for it, and returns the one to use instead, e.g. to trace requests or
+	// to record and replay them in tests.
+	RoundTripper func(config.Remote, http.RoundTripper) http.RoundTripper
+
+	mutex   sync.Mutex
+	clients map[string]cachedClient
+}
+
+type cachedClient struct {
+	remote config.Remote
+	client *agentclient.Client
+}
 
 func (f *APIClientFactory) New(r config.Remote) client.Client {
-	return &client.APIClient{
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	// A remote whose settings have changed, such as its timeouts, gets a new
+	// client.
+	if cached, ok := f.clients[r.Name]; ok && reflect.DeepEqual(cached.remote, r) {
+		return cached.client
+	}
+
+	c := agentClient(r)
+	if f.RoundTripper != nil {
+		c.WrapTransport = func(base http.RoundTripper) http.RoundTripper {
+			return f.RoundTripper(r, base)
+		}
+	}
+	if f.clients == nil {
+		f.clients = map[string]cachedClient{}
+	}
+	f.clients[r.Name] = cachedClient{remote: r, client: c}
+	return c
+}
+
+func agentClient(r config.Remote) *agentclient.Client {
+	return &agentclient.Client{
 		Endpoint:   r.Endpoint,
 		Username:   r.Username,
 		Password:   r.Password,
 		PrivateKey: r.PrivateKey,
+		Timeouts:   remoteTimeouts(r),
+		Proxy:      r.Proxy,
+		CAFiles:    remoteCAFiles(r),
+		ClientCert: r.ClientCert,
+		ClientKey:  r.ClientKey,
+	}
+}
+
+// remoteCAFiles returns the CA bundles to trust for the remote, besides the
+// certificate in its token.
+func remoteCAFiles(r config.Remote) []string {
+	var files []string
+	if r.CABundle != "" {
+		files = append(files, r.CABundle)
+	}
+	if CommandCAFile != "" {
+		files = append(files, CommandCAFile)
+	}
+	return files
+}
+
+// remoteTimeouts returns the timeouts for calls to the remote, falling back
+// to the defaults for any that the remote doesn't set.
+func remoteTimeouts(r config.Remote) agentclient.Timeouts {
+	if CommandTimeout > 0 {
+		return agentclient.Timeouts{Read: CommandTimeout, Mutate: CommandTimeout}
+	}
+
+	t := agentclient.DefaultTimeouts
+	if r.Timeouts != nil {
+		if r.Timeouts.Read > 0 {
+			t.Read = time.Duration(r.Timeouts.Read)
+		}
+		if r.Timeouts.Mutate > 0 {
+			t.Mutate = time.Duration(r.Timeouts.Mutate)
+		}
 	}
+	return t
 }
@@ -1,20 +1,35 @@
 package actions
 
 import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
 	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+	"github.com/CenturyLinkLabs/panamaxcli/agentclient"
 	"github.com/CenturyLinkLabs/panamaxcli/config"
 	"github.com/stretchr/testify/assert"
 )
 
 type FakeFactory struct {
 	NewedRemotes []config.Remote
+	// Clients, when set, provides a distinct client for each remote name.
+	// Remotes without an entry get the shared fakeClient.
+	Clients map[string]*FakeClient
+	mutex   sync.Mutex
 }
 
 func (f *FakeFactory) New(r config.Remote) client.Client {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	f.NewedRemotes = append(f.NewedRemotes, r)
+	if c, ok := f.Clients[r.Name]; ok {
+		return c
+	}
 	return &fakeClient
 }
 
@@ -78,14 +93,70 @@ func init() {
 func setupFactory() {
 	fakeFactory = FakeFactory{}
 	fakeClient = FakeClient{}
+	DefaultJournal = nil
 }
 
 func TestAPIClientFactoryNew(t *testing.T) {
 	r := config.Remote{Endpoint: "http://example.com"}
 	f := APIClientFactory{}
 	c := f.New(r)
-	ac, ok := c.(*client.APIClient)
+	ac, ok := c.(*agentclient.Client)
 	if assert.True(t, ok) {
 		assert.Equal(t, "http://example.com", ac.Endpoint)
+		assert.Equal(t, agentclient.DefaultTimeouts, ac.Timeouts)
 	}
 }
+
+func TestAPIClientFactoryReusesClients(t *testing.T) {
+	f := APIClientFactory{}
+	r := config.Remote{Name: "Test", Endpoint: "http://example.com"}
+
+	c := f.New(r)
+	assert.True(t, c == f.New(r))
+	assert.False(t, c == f.New(config.Remote{Name: "Other", Endpoint: "http://example.com"}))
+
+	r.Timeouts = &config.Timeouts{Read: config.Duration(time.Minute)}
+	updated := f.New(r)
+	assert.False(t, c == updated)
+	assert.Equal(t, time.Minute, updated.(*agentclient.Client).Timeouts.Read)
+	assert.True(t, updated == f.New(r))
+}
+
+type recordingTransport struct {
+	Requests []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Requests = append(t.Requests, req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`[]`)),
+		Request:    req,
+	}, nil
+}
+
+func TestAPIClientFactoryRoundTripper(t *testing.T) {
+	rt := &recordingTransport{}
+	var remotes []string
+	f := APIClientFactory{RoundTripper: func(r config.Remote, base http.RoundTripper) http.RoundTripper {
+		remotes = append(remotes, r.Name)
+		return rt
+	}}
+
+	c := f.New(config.Remote{Name: "Test", Endpoint: "https://agent.example.com:3001"})
+	_, err := c.ListDeployments()
+	assert.NoError(t, err)
+	_, err = c.ListDeployments()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Test"}, remotes)
+	assert.Equal(t, []string{"https://agent.example.com:3001/deployments", "https://agent.example.com:3001/deployments"}, rt.Requests)
+}
+
+func TestRemoteTimeouts(t *testing.T) {
+	r := config.Remote{Timeouts: &config.Timeouts{Mutate: config.Duration(10 * time.Minute)}}
+	assert.Equal(t, agentclient.Timeouts{Read: 10 * time.Second, Mutate: 10 * time.Minute}, remoteTimeouts(r))
+
+	CommandTimeout = time.Minute
+	defer func() { CommandTimeout = 0 }()
+	assert.Equal(t, agentclient.Timeouts{Read: time.Minute, Mutate: time.Minute}, remoteTimeouts(r))
+}
@@ -1,14 +1,18 @@
 package actions
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
 	"github.com/CenturyLinkLabs/panamaxcli/config"
 	"github.com/CenturyLinkLabs/prettycli"
-	"github.com/ghodss/yaml"
 )
 
 func ListDeployments(remote config.Remote) (prettycli.Output, error) {
@@ -34,6 +38,67 @@ func ListDeployments(remote config.Remote) (prettycli.Output, error) {
 	return &o, nil
 }
 
+// ListAllDeployments lists the deployments on every one of the remotes in a
+// single table. Remotes that can't be reached are warned about on stderr.
+func ListAllDeployments(remotes []config.Remote) (prettycli.Output, error) {
+	return listDeploymentsAcross(remotes, func(agent.DeploymentResponseLite) bool {
+		return true
+	})
+}
+
+// FindDeployments searches the deployments on every one of the remotes for
+// those whose ID, name, or one of whose service IDs contains the pattern,
+// ignoring case.
+func FindDeployments(remotes []config.Remote, pattern string) (prettycli.Output, error) {
+	pattern = strings.ToLower(pattern)
+	return listDeploymentsAcross(remotes, func(d agent.DeploymentResponseLite) bool {
+		if strconv.Itoa(d.ID) == pattern || strings.Contains(strings.ToLower(d.Name), pattern) {
+			return true
+		}
+		for _, id := range d.ServiceIDs {
+			if strings.Contains(strings.ToLower(id), pattern) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func listDeploymentsAcross(remotes []config.Remote, match func(agent.DeploymentResponseLite) bool) (prettycli.Output, error) {
+	if len(remotes) == 0 {
+		return prettycli.PlainOutput{}, errors.New("no remotes were selected")
+	}
+
+	results := fanOut(remotes, 0, 0, func(r config.Remote) (interface{}, error) {
+		return DefaultAgentClientFactory.New(r).ListDeployments()
+	})
+
+	o := prettycli.ListOutput{Labels: []string{"Remote", "ID", "Name", "Services"}}
+	for _, res := range results {
+		if res.Err != nil {
+			warnf("the remote '%s' is unreachable: %s", res.Remote.Name, res.Err)
+			continue
+		}
+
+		for _, d := range res.Value.([]agent.DeploymentResponseLite) {
+			if !match(d) {
+				continue
+			}
+			o.AddRow(map[string]string{
+				"Remote":   res.Remote.Name,
+				"ID":       strconv.Itoa(d.ID),
+				"Name":     d.Name,
+				"Services": strconv.Itoa(len(d.ServiceIDs)),
+			})
+		}
+	}
+
+	if len(o.Rows) == 0 {
+		return prettycli.PlainOutput{"No Deployments"}, nil
+	}
+	return &o, nil
+}
+
 func DescribeDeployment(remote config.Remote, id string) (prettycli.Output, error) {
 	c := DefaultAgentClientFactory.New(remote)
 	desc, err := c.DescribeDeployment(id)
@@ -65,22 +130,421 @@ func DescribeDeployment(remote config.Remote, id string) (prettycli.Output, erro
 }
 
 func CreateDeployment(remote config.Remote, path string) (prettycli.Output, error) {
-	templateBytes, err := ioutil.ReadFile(path)
+	b, err := readTemplateFile(path)
 	if err != nil {
 		return prettycli.PlainOutput{}, err
 	}
 
-	bp := agent.DeploymentBlueprint{}
-	if err := yaml.Unmarshal(templateBytes, &bp.Template); err != nil {
+	dr, err := createWithOverride(remote, templateSource{Path: path, Template: b}, "")
+	if err != nil {
 		return prettycli.PlainOutput{}, err
 	}
 
-	dr, err := DefaultAgentClientFactory.New(remote).CreateDeployment(bp)
+	return prettycli.PlainOutput{fmt.Sprintf("Template successfully deployed as '%d'", dr.ID)}, nil
+}
+
+// MultiCreateOptions controls how CreateDeployments rolls a template out to
+// several remotes.
+type MultiCreateOptions struct {
+	// OverrideDir is searched for a "<remote name>.pmx" file for each remote,
+	// which will be used as that remote's override template when it exists.
+	OverrideDir string
+	// Concurrency is the maximum number of remotes deployed to at once.
+	Concurrency int
+	// StopOnError prevents deployments to any remotes that haven't been
+	// started yet once one of them fails.
+	StopOnError bool
+}
+
+var errSkippedDeployment = errors.New("skipped after an earlier failure")
+
+// CreateDeployments deploys the template at path to every one of the remotes
+// concurrently, and reports the outcome for each in a table. An error is
+// returned alongside the table when any deployment did not succeed.
+func CreateDeployments(remotes []config.Remote, path string, opts MultiCreateOptions) (prettycli.Output, error) {
+	if len(remotes) == 0 {
+		return prettycli.PlainOutput{}, errors.New("no remotes were selected")
+	}
+
+	b, err := readTemplateFile(path)
 	if err != nil {
 		return prettycli.PlainOutput{}, err
 	}
+	if err := parseTemplate(b, &agent.Template{}); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
 
-	return prettycli.PlainOutput{fmt.Sprintf("Template successfully deployed as '%d'", dr.ID)}, nil
+	var mutex sync.Mutex
+	failed := false
+	results := fanOut(remotes, opts.Concurrency, 0, func(r config.Remote) (interface{}, error) {
+		mutex.Lock()
+		skip := opts.StopOnError && failed
+		mutex.Unlock()
+		if skip {
+			return nil, errSkippedDeployment
+		}
+
+		dr, err := createWithOverride(r, templateSource{Path: path, Template: b}, opts.OverrideDir)
+		if err != nil {
+			mutex.Lock()
+			failed = true
+			mutex.Unlock()
+		}
+		return dr, err
+	})
+
+	o := prettycli.ListOutput{Labels: []string{"Remote", "Result", "ID", "Error"}}
+	failures := 0
+	for _, res := range results {
+		row := map[string]string{"Remote": res.Remote.Name}
+		switch res.Err {
+		case nil:
+			row["Result"] = "deployed"
+			row["ID"] = strconv.Itoa(res.Value.(agent.DeploymentResponseLite).ID)
+		case errSkippedDeployment:
+			failures++
+			row["Result"] = "skipped"
+		default:
+			failures++
+			row["Result"] = "failed"
+			row["Error"] = res.Err.Error()
+		}
+		o.AddRow(row)
+	}
+
+	if failures > 0 {
+		return &o, fmt.Errorf("the template was not deployed to %d of %d remotes", failures, len(remotes))
+	}
+	return &o, nil
+}
+
+// createWithOverride deploys the template in src to the remote using the
+// remote's override template from overrideDir if there is one, and records
+// the deployment in the journal.
+func createWithOverride(r config.Remote, src templateSource, overrideDir string) (agent.DeploymentResponseLite, error) {
+	if overrideDir != "" {
+		overridePath := filepath.Join(overrideDir, r.Name+".pmx")
+		if _, err := os.Stat(overridePath); err == nil {
+			override, err := readTemplateFile(overridePath)
+			if err != nil {
+				return agent.DeploymentResponseLite{}, err
+			}
+			src.OverridePath, src.Override = overridePath, override
+		}
+	}
+
+	bp, err := src.blueprint()
+	if err != nil {
+		return agent.DeploymentResponseLite{}, err
+	}
+	return deployBlueprint(r, bp, src)
+}
+
+// deployBlueprint creates a deployment from the blueprint and records it in
+// the journal as coming from src.
+func deployBlueprint(r config.Remote, bp agent.DeploymentBlueprint, src templateSource) (agent.DeploymentResponseLite, error) {
+	dr, err := createDeployment(DefaultAgentClientFactory.New(r), bp)
+	if err != nil {
+		return dr, err
+	}
+
+	if dr.Name == "" {
+		dr.Name = bp.Template.Name
+	}
+	recordCreate(r, dr, src)
+	return dr, nil
+}
+
+// PromoteOptions controls how PromoteDeployment recreates a deployment on
+// another remote.
+type PromoteOptions struct {
+	// TemplatePath is the template to deploy. When it is empty, the template
+	// recorded in the journal when the deployment was created is used.
+	TemplatePath string
+	// OverrideDir is searched for a "<remote name>.pmx" override template for
+	// the target remote.
+	OverrideDir string
+	// Wait, when true, waits up to WaitTimeout for the new deployment's
+	// services to be running.
+	Wait        bool
+	WaitTimeout time.Duration
+	// Replace deletes any deployments on the target remote with the same name
+	// as the promoted one, once it has been created.
+	Replace bool
+}
+
+// PromoteDeployment recreates the deployment with the given ID on the from
+// remote on the to remote, using the template it was originally deployed
+// from.
+func PromoteDeployment(from config.Remote, to config.Remote, id string, opts PromoteOptions) (prettycli.Output, error) {
+	desc, err := DefaultAgentClientFactory.New(from).DescribeDeployment(id)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	path := opts.TemplatePath
+	var template []byte
+	if path != "" {
+		if template, err = readTemplateFile(path); err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+	} else {
+		var found bool
+		template, path, found, err = recordedTemplate(from, desc.ID)
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		if !found {
+			return prettycli.PlainOutput{}, fmt.Errorf("no template was recorded for deployment '%s' on '%s', supply one with --template", id, from.Name)
+		}
+	}
+
+	target := DefaultAgentClientFactory.New(to)
+	var previous []agent.DeploymentResponseLite
+	if opts.Replace {
+		deps, err := target.ListDeployments()
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		for _, d := range deps {
+			if d.Name == desc.Name {
+				previous = append(previous, d)
+			}
+		}
+	}
+
+	dr, err := createWithOverride(to, templateSource{Path: path, Template: template}, opts.OverrideDir)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	lines := []string{fmt.Sprintf("Promoted '%s' from '%s' to '%s' as deployment '%d'", desc.Name, from.Name, to.Name, dr.ID)}
+
+	if opts.Wait {
+		if err := waitForHealthy(target, dr.ID, opts.WaitTimeout); err != nil {
+			return prettycli.PlainOutput{strings.Join(lines, "\n")}, err
+		}
+		lines = append(lines, fmt.Sprintf("Deployment '%d' is healthy", dr.ID))
+	}
+
+	for _, d := range previous {
+		if err := target.DeleteDeployment(strconv.Itoa(d.ID)); err != nil {
+			return prettycli.PlainOutput{strings.Join(lines, "\n")}, err
+		}
+		recordDelete(to, d.ID)
+		lines = append(lines, fmt.Sprintf("Deleted previous deployment '%d' on '%s'", d.ID, to.Name))
+	}
+
+	return prettycli.PlainOutput{strings.Join(lines, "\n")}, nil
+}
+
+// RollbackOptions controls which revision RollbackDeployment returns a
+// deployment to.
+type RollbackOptions struct {
+	// To is the revision to roll back to, as numbered by DeploymentHistory.
+	// When it is zero, the revision before the current one is used.
+	To int
+	// Wait, when true, waits up to WaitTimeout for the recreated deployment's
+	// services to be running.
+	Wait        bool
+	WaitTimeout time.Duration
+}
+
+// RollbackDeployment replaces the deployments with the given name on the
+// remote with one created from an earlier revision of its template and
+// override template, as recorded in the journal.
+func RollbackDeployment(remote config.Remote, name string, opts RollbackOptions) (prettycli.Output, error) {
+	revisions, err := deploymentRevisions(remote, name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	to := opts.To
+	switch {
+	case len(revisions) == 0:
+		return prettycli.PlainOutput{}, fmt.Errorf("no revisions of '%s' on '%s' were recorded", name, remote.Name)
+	case to == 0 && len(revisions) == 1:
+		return prettycli.PlainOutput{}, fmt.Errorf("'%s' on '%s' has no earlier revision to roll back to", name, remote.Name)
+	case to == 0:
+		to = len(revisions) - 1
+	case to < 0 || to > len(revisions):
+		return prettycli.PlainOutput{}, fmt.Errorf("revision %d of '%s' does not exist, it has %d revision(s)", to, name, len(revisions))
+	}
+
+	src, err := recordedSource(revisions[to-1])
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	bp, err := src.blueprint()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	bp.Template.Name = name
+
+	c := DefaultAgentClientFactory.New(remote)
+	deps, err := c.ListDeployments()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	var lines []string
+	for _, d := range deps {
+		if d.Name != name {
+			continue
+		}
+		if err := c.DeleteDeployment(strconv.Itoa(d.ID)); err != nil {
+			return prettycli.PlainOutput{strings.Join(lines, "\n")}, err
+		}
+		recordDelete(remote, d.ID)
+		lines = append(lines, fmt.Sprintf("Deleted deployment '%d'", d.ID))
+	}
+
+	dr, err := createDeployment(c, bp)
+	if err != nil {
+		return prettycli.PlainOutput{strings.Join(lines, "\n")}, err
+	}
+	dr.Name = name
+	recordDeployed("rollback", remote, dr, src)
+	lines = append(lines, fmt.Sprintf("Rolled back '%s' to revision %d as deployment '%d'", name, to, dr.ID))
+
+	if opts.Wait {
+		if err := waitForHealthy(c, dr.ID, opts.WaitTimeout); err != nil {
+			return prettycli.PlainOutput{strings.Join(lines, "\n")}, err
+		}
+		lines = append(lines, fmt.Sprintf("Deployment '%d' is healthy", dr.ID))
+	}
+
+	return prettycli.PlainOutput{strings.Join(lines, "\n")}, nil
+}
+
+// UpgradeOptions controls how UpgradeDeployment replaces a deployment.
+type UpgradeOptions struct {
+	// CreateFirst creates the new deployment and waits up to WaitTimeout for
+	// it to be healthy before deleting the old one, rather than deleting the
+	// old one first. This avoids downtime, but only works when the two
+	// deployments' ports don't collide.
+	CreateFirst bool
+	WaitTimeout time.Duration
+}
+
+// UpgradeDeployment replaces the deployment with the given ID or name on the
+// remote with one created from the template at path, under the same name. The
+// output starts with the changes from the template last recorded for the
+// deployment. Any override template that was recorded is used again.
+func UpgradeDeployment(remote config.Remote, ref string, path string, opts UpgradeOptions) (prettycli.Output, error) {
+	template, err := readTemplateFile(path)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	c := DefaultAgentClientFactory.New(remote)
+	deps, err := c.ListDeployments()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	old, err := findDeployment(deps, ref)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	src := templateSource{Path: path, Template: template}
+	co := prettycli.CombinedOutput{}
+	e, found, err := latestEntry(remote, old.ID)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if found && e.TemplateHash != "" {
+		recorded, err := recordedSource(e)
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		src.OverridePath, src.Override = recorded.OverridePath, recorded.Override
+
+		changes := diffLines(string(recorded.Template), string(template))
+		if len(changes) == 0 {
+			changes = []string{"The template has not changed."}
+		}
+		co.AddOutput("Changes", prettycli.PlainOutput{strings.Join(changes, "\n")})
+	} else {
+		co.AddOutput("Changes", prettycli.PlainOutput{fmt.Sprintf("No template was recorded for deployment '%d', so there is nothing to compare with.", old.ID)})
+	}
+
+	bp, err := src.blueprint()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	bp.Template.Name = old.Name
+
+	var lines []string
+	result := func(err error) (prettycli.Output, error) {
+		co.AddOutput("", prettycli.PlainOutput{strings.Join(lines, "\n")})
+		return &co, err
+	}
+	deleteOld := func() error {
+		if err := c.DeleteDeployment(strconv.Itoa(old.ID)); err != nil {
+			return err
+		}
+		recordDelete(remote, old.ID)
+		lines = append(lines, fmt.Sprintf("Deleted deployment '%d'", old.ID))
+		return nil
+	}
+
+	if !opts.CreateFirst {
+		if err := deleteOld(); err != nil {
+			return result(err)
+		}
+	}
+
+	dr, err := createDeployment(c, bp)
+	if err != nil {
+		return result(err)
+	}
+	dr.Name = old.Name
+	recordDeployed("upgrade", remote, dr, src)
+	lines = append(lines, fmt.Sprintf("Upgraded '%s' as deployment '%d'", old.Name, dr.ID))
+
+	if opts.CreateFirst {
+		if err := waitForHealthy(c, dr.ID, opts.WaitTimeout); err != nil {
+			return result(err)
+		}
+		lines = append(lines, fmt.Sprintf("Deployment '%d' is healthy", dr.ID))
+		if err := deleteOld(); err != nil {
+			return result(err)
+		}
+	}
+
+	return result(nil)
+}
+
+// findDeployment finds the deployment with ref as its ID or, failing that, the
+// only deployment with ref as its name.
+func findDeployment(deps []agent.DeploymentResponseLite, ref string) (agent.DeploymentResponseLite, error) {
+	var named []agent.DeploymentResponseLite
+	for _, d := range deps {
+		if strconv.Itoa(d.ID) == ref {
+			return d, nil
+		}
+		if d.Name == ref {
+			named = append(named, d)
+		}
+	}
+
+	switch len(named) {
+	case 0:
+		return agent.DeploymentResponseLite{}, fmt.Errorf("no deployment has the ID or name '%s'", ref)
+	case 1:
+		return named[0], nil
+	default:
+		return agent.DeploymentResponseLite{}, fmt.Errorf("%d deployments are named '%s', use an ID instead", len(named), ref)
+	}
+}
+
+func readTemplate(path string, t *agent.Template) error {
+	templateBytes, err := readTemplateFile(path)
+	if err != nil {
+		return err
+	}
+
+	return parseTemplate(templateBytes, t)
 }
 
 func RedeployDeployment(remote config.Remote, id string) (prettycli.Output, error) {
@@ -90,6 +554,10 @@ func RedeployDeployment(remote config.Remote, id string) (prettycli.Output, erro
 		return prettycli.PlainOutput{}, err
 	}
 
+	if previousID, err := strconv.Atoi(id); err == nil {
+		recordRedeploy(remote, previousID, desc)
+	}
+
 	o := prettycli.PlainOutput{fmt.Sprintf("Redeployed '%s' as Deployment ID %d", desc.Name, desc.ID)}
 	return &o, nil
 }
@@ -99,6 +567,9 @@ func DeleteDeployment(remote config.Remote, id string) (prettycli.Output, error)
 	if err := c.DeleteDeployment(id); err != nil {
 		return prettycli.PlainOutput{}, err
 	}
+	if deletedID, err := strconv.Atoi(id); err == nil {
+		recordDelete(remote, deletedID)
+	}
 
 	o := prettycli.PlainOutput{fmt.Sprintf("Successfully deleted deployment '%s'", id)}
 	return &o, nil
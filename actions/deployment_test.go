@@ -1,10 +1,12 @@
 package actions
 
 import (
+	"bytes"
 	"errors"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
 	"github.com/CenturyLinkLabs/panamaxcli/config"
@@ -155,6 +157,7 @@ func TestRedeployDeployment(t *testing.T) {
 		Name:       "Test Name",
 		ServiceIDs: []string{"wp", "db"},
 	}
+	j := setupJournal()
 	r := config.Remote{}
 	o, err := RedeployDeployment(r, "1")
 	assert.Equal(t, "1", fakeClient.RedeployedDeployment)
@@ -164,6 +167,11 @@ func TestRedeployDeployment(t *testing.T) {
 		"Redeployed 'Test Name' as Deployment ID 2",
 		o.ToPrettyOutput(),
 	)
+	if assert.Len(t, j.Recorded, 1) {
+		assert.Equal(t, "redeploy", j.Recorded[0].Action)
+		assert.Equal(t, 2, j.Recorded[0].DeploymentID)
+		assert.Equal(t, 1, j.Recorded[0].PreviousID)
+	}
 }
 
 func TestRedeployDeploymentErrored(t *testing.T) {
@@ -178,12 +186,17 @@ func TestRedeployDeploymentErrored(t *testing.T) {
 
 func TestDeleteDeployment(t *testing.T) {
 	setupFactory()
+	j := setupJournal()
 	r := config.Remote{}
 	o, err := DeleteDeployment(r, "1")
 
 	assert.Equal(t, "1", fakeClient.DeletedDeployment)
 	assert.NoError(t, err)
 	assert.Equal(t, "Successfully deleted deployment '1'", o.ToPrettyOutput())
+	if assert.Len(t, j.Recorded, 1) {
+		assert.Equal(t, "delete", j.Recorded[0].Action)
+		assert.Equal(t, 1, j.Recorded[0].DeploymentID)
+	}
 }
 
 func TestErroredDeleteDeployment(t *testing.T) {
@@ -195,3 +208,470 @@ func TestErroredDeleteDeployment(t *testing.T) {
 	assert.EqualError(t, err, "Delete Error")
 	assert.Equal(t, "", o.ToPrettyOutput())
 }
+
+func setupMultiRemoteClients() []config.Remote {
+	setupFactory()
+	fakeFactory.Clients = map[string]*FakeClient{
+		"East": {Deployments: []agent.DeploymentResponseLite{
+			{ID: 1, Name: "Wordpress", ServiceIDs: []string{"wp.service", "db.service"}},
+			{ID: 2, Name: "Redis", ServiceIDs: []string{"redis.service"}},
+		}},
+		"West": {Deployments: []agent.DeploymentResponseLite{
+			{ID: 7, Name: "WordPress Staging", ServiceIDs: []string{"wp.service"}},
+		}},
+		"Dead": {ErrorForDeploymentList: errors.New("connection refused")},
+	}
+	return []config.Remote{{Name: "East"}, {Name: "West"}, {Name: "Dead"}}
+}
+
+func TestListAllDeployments(t *testing.T) {
+	remotes := setupMultiRemoteClients()
+	var warnings bytes.Buffer
+	Warnings = &warnings
+	defer func() { Warnings = os.Stderr }()
+
+	o, err := ListAllDeployments(remotes)
+	assert.NoError(t, err)
+
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 3) {
+		assert.Equal(t, "East", lo.Rows[0]["Remote"])
+		assert.Equal(t, "1", lo.Rows[0]["ID"])
+		assert.Equal(t, "Wordpress", lo.Rows[0]["Name"])
+		assert.Equal(t, "2", lo.Rows[0]["Services"])
+		assert.Equal(t, "West", lo.Rows[2]["Remote"])
+	}
+	assert.Equal(t, "Warning: the remote 'Dead' is unreachable: connection refused\n", warnings.String())
+}
+
+func TestListAllDeploymentsNoWarnings(t *testing.T) {
+	remotes := setupMultiRemoteClients()
+	var warnings bytes.Buffer
+	Warnings = &warnings
+	defer func() { Warnings = os.Stderr }()
+
+	o, err := ListAllDeployments(remotes[:2])
+	assert.NoError(t, err)
+
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) {
+		assert.Len(t, lo.Rows, 3)
+	}
+	assert.Empty(t, warnings.String())
+}
+
+func TestErroredNoRemotesListAllDeployments(t *testing.T) {
+	o, err := ListAllDeployments(nil)
+	assert.EqualError(t, err, "no remotes were selected")
+	assert.Equal(t, prettycli.PlainOutput{}, o)
+}
+
+func TestFindDeploymentsByName(t *testing.T) {
+	remotes := setupMultiRemoteClients()
+	o, err := FindDeployments(remotes[:2], "wordpress")
+	assert.NoError(t, err)
+
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 2) {
+		assert.Equal(t, "East", lo.Rows[0]["Remote"])
+		assert.Equal(t, "Wordpress", lo.Rows[0]["Name"])
+		assert.Equal(t, "West", lo.Rows[1]["Remote"])
+		assert.Equal(t, "WordPress Staging", lo.Rows[1]["Name"])
+	}
+}
+
+func TestFindDeploymentsByServiceID(t *testing.T) {
+	remotes := setupMultiRemoteClients()
+	o, err := FindDeployments(remotes[:2], "redis.service")
+	assert.NoError(t, err)
+
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 1) {
+		assert.Equal(t, "Redis", lo.Rows[0]["Name"])
+	}
+}
+
+func TestFindDeploymentsByID(t *testing.T) {
+	remotes := setupMultiRemoteClients()
+	o, err := FindDeployments(remotes[:2], "7")
+	assert.NoError(t, err)
+
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 1) {
+		assert.Equal(t, "West", lo.Rows[0]["Remote"])
+	}
+}
+
+func TestFindDeploymentsNoMatches(t *testing.T) {
+	remotes := setupMultiRemoteClients()
+	o, err := FindDeployments(remotes[:2], "nothing")
+	assert.NoError(t, err)
+	assert.Equal(t, "No Deployments", o.ToPrettyOutput())
+}
+
+func TestCreateDeployments(t *testing.T) {
+	setupFactory()
+	east, west := &FakeClient{}, &FakeClient{}
+	east.DeployedDeployment = agent.DeploymentResponseLite{ID: 3}
+	west.DeployedDeployment = agent.DeploymentResponseLite{ID: 9}
+	fakeFactory.Clients = map[string]*FakeClient{"East": east, "West": west}
+	template := setupTemplateFile(t, wordpressTemplate)
+	defer os.Remove(template)
+
+	overrideDir, err := ioutil.TempDir("", "pmx-overrides")
+	assert.NoError(t, err)
+	defer os.RemoveAll(overrideDir)
+	override := "images:\n- name: DB\n  environment:\n  - variable: MYSQL_ROOT_PASSWORD\n    value: west\n"
+	assert.NoError(t, ioutil.WriteFile(overrideDir+"/West.pmx", []byte(override), 0600))
+
+	remotes := []config.Remote{{Name: "East"}, {Name: "West"}}
+	o, err := CreateDeployments(remotes, template, MultiCreateOptions{OverrideDir: overrideDir})
+	assert.NoError(t, err)
+
+	assert.Len(t, east.DeployedBlueprint.Template.Images, 2)
+	assert.Empty(t, east.DeployedBlueprint.Override.Images)
+	if assert.Len(t, west.DeployedBlueprint.Override.Images, 1) {
+		img := west.DeployedBlueprint.Override.Images[0]
+		assert.Equal(t, "DB", img.Name)
+		assert.Equal(t, "west", img.Environment[0].Value)
+	}
+
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 2) {
+		assert.Equal(t, "East", lo.Rows[0]["Remote"])
+		assert.Equal(t, "deployed", lo.Rows[0]["Result"])
+		assert.Equal(t, "3", lo.Rows[0]["ID"])
+		assert.Equal(t, "9", lo.Rows[1]["ID"])
+	}
+}
+
+func TestBestEffortCreateDeployments(t *testing.T) {
+	setupFactory()
+	fakeFactory.Clients = map[string]*FakeClient{
+		"Bad":  {ErrorForDeploymentCreate: errors.New("test error")},
+		"Good": {DeployedDeployment: agent.DeploymentResponseLite{ID: 1}},
+	}
+	template := setupTemplateFile(t, wordpressTemplate)
+	defer os.Remove(template)
+
+	remotes := []config.Remote{{Name: "Bad"}, {Name: "Good"}}
+	o, err := CreateDeployments(remotes, template, MultiCreateOptions{Concurrency: 1})
+	assert.EqualError(t, err, "the template was not deployed to 1 of 2 remotes")
+
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 2) {
+		assert.Equal(t, "failed", lo.Rows[0]["Result"])
+		assert.Equal(t, "test error", lo.Rows[0]["Error"])
+		assert.Equal(t, "deployed", lo.Rows[1]["Result"])
+	}
+}
+
+func TestStopOnErrorCreateDeployments(t *testing.T) {
+	setupFactory()
+	good := &FakeClient{}
+	fakeFactory.Clients = map[string]*FakeClient{
+		"Bad":  {ErrorForDeploymentCreate: errors.New("test error")},
+		"Good": good,
+	}
+	template := setupTemplateFile(t, wordpressTemplate)
+	defer os.Remove(template)
+
+	remotes := []config.Remote{{Name: "Bad"}, {Name: "Good"}}
+	opts := MultiCreateOptions{Concurrency: 1, StopOnError: true}
+	o, err := CreateDeployments(remotes, template, opts)
+	assert.EqualError(t, err, "the template was not deployed to 2 of 2 remotes")
+	assert.Empty(t, good.DeployedBlueprint.Template.Images)
+
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 2) {
+		assert.Equal(t, "failed", lo.Rows[0]["Result"])
+		assert.Equal(t, "skipped", lo.Rows[1]["Result"])
+	}
+}
+
+func TestErroredNoRemotesCreateDeployments(t *testing.T) {
+	o, err := CreateDeployments(nil, "template.pmx", MultiCreateOptions{})
+	assert.EqualError(t, err, "no remotes were selected")
+	assert.Equal(t, prettycli.PlainOutput{}, o)
+}
+
+func TestErroredMissingFileCreateDeployments(t *testing.T) {
+	setupFactory()
+	remotes := []config.Remote{{Name: "Test"}}
+	o, err := CreateDeployments(remotes, "Bad Path", MultiCreateOptions{})
+	assert.Contains(t, err.Error(), "no such file")
+	assert.Equal(t, prettycli.PlainOutput{}, o)
+}
+
+func TestCreateDeploymentRecordsJournal(t *testing.T) {
+	setupFactory()
+	j := setupJournal()
+	template := setupTemplateFile(t, wordpressTemplate)
+	defer os.Remove(template)
+	fakeClient.DeployedDeployment = agent.DeploymentResponseLite{ID: 5}
+
+	_, err := CreateDeployment(config.Remote{Name: "Test"}, template)
+	assert.NoError(t, err)
+	if assert.Len(t, j.Recorded, 1) {
+		e := j.Recorded[0]
+		assert.Equal(t, "create", e.Action)
+		assert.Equal(t, "Test", e.Remote)
+		assert.Equal(t, 5, e.DeploymentID)
+		assert.Equal(t, "Wordpress with MySQL", e.Name)
+		assert.Equal(t, template, e.TemplatePath)
+		assert.Equal(t, wordpressTemplate, string(j.Templates[e.TemplateHash]))
+	}
+}
+
+func setupPromotion() (*FakeClient, *FakeClient) {
+	setupFactory()
+	healthPollInterval = time.Millisecond
+	staging := &FakeClient{
+		DeploymentDescription: agent.DeploymentResponseFull{ID: 1, Name: "Wordpress with MySQL"},
+	}
+	prod := &FakeClient{
+		Deployments: []agent.DeploymentResponseLite{
+			{ID: 8, Name: "Wordpress with MySQL"},
+			{ID: 9, Name: "Other"},
+		},
+		DeployedDeployment:    agent.DeploymentResponseLite{ID: 10},
+		DeploymentDescription: servicesInState("running"),
+	}
+	fakeFactory.Clients = map[string]*FakeClient{"Staging": staging, "Prod": prod}
+	return staging, prod
+}
+
+func TestPromoteDeploymentFromJournal(t *testing.T) {
+	staging, prod := setupPromotion()
+	j := setupJournal()
+	j.Record(config.JournalEntry{Remote: "Staging", DeploymentID: 1, TemplatePath: "wp.pmx"}, []byte(wordpressTemplate), nil)
+
+	from, to := config.Remote{Name: "Staging"}, config.Remote{Name: "Prod"}
+	o, err := PromoteDeployment(from, to, "1", PromoteOptions{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "1", staging.DescribedDeployment)
+	assert.Len(t, prod.DeployedBlueprint.Template.Images, 2)
+	assert.Empty(t, prod.DeletedDeployment)
+	assert.Equal(t, "Promoted 'Wordpress with MySQL' from 'Staging' to 'Prod' as deployment '10'", o.ToPrettyOutput())
+
+	if assert.Len(t, j.Recorded, 2) {
+		assert.Equal(t, "Prod", j.Recorded[1].Remote)
+		assert.Equal(t, 10, j.Recorded[1].DeploymentID)
+		assert.Equal(t, "wp.pmx", j.Recorded[1].TemplatePath)
+	}
+}
+
+func TestPromoteDeploymentWaitAndReplace(t *testing.T) {
+	_, prod := setupPromotion()
+	j := setupJournal()
+	template := setupTemplateFile(t, wordpressTemplate)
+	defer os.Remove(template)
+
+	from, to := config.Remote{Name: "Staging"}, config.Remote{Name: "Prod"}
+	opts := PromoteOptions{TemplatePath: template, Wait: true, WaitTimeout: time.Second, Replace: true}
+	o, err := PromoteDeployment(from, to, "1", opts)
+	assert.NoError(t, err)
+
+	assert.Equal(t, "10", prod.DescribedDeployment)
+	assert.Equal(t, "8", prod.DeletedDeployment)
+	assert.Equal(t, `Promoted 'Wordpress with MySQL' from 'Staging' to 'Prod' as deployment '10'
+Deployment '10' is healthy
+Deleted previous deployment '8' on 'Prod'`, o.ToPrettyOutput())
+	if assert.Len(t, j.Recorded, 2) {
+		assert.Equal(t, "create", j.Recorded[0].Action)
+		assert.Equal(t, "delete", j.Recorded[1].Action)
+		assert.Equal(t, "Prod", j.Recorded[1].Remote)
+		assert.Equal(t, 8, j.Recorded[1].DeploymentID)
+	}
+}
+
+func TestUnhealthyPromoteDeploymentKeepsPrevious(t *testing.T) {
+	_, prod := setupPromotion()
+	prod.DeploymentDescription = servicesInState("failed")
+	template := setupTemplateFile(t, wordpressTemplate)
+	defer os.Remove(template)
+
+	from, to := config.Remote{Name: "Staging"}, config.Remote{Name: "Prod"}
+	opts := PromoteOptions{TemplatePath: template, Wait: true, WaitTimeout: 5 * time.Millisecond, Replace: true}
+	o, err := PromoteDeployment(from, to, "1", opts)
+	assert.EqualError(t, err, "deployment '10' was not healthy after 5ms")
+	assert.Contains(t, o.ToPrettyOutput(), "as deployment '10'")
+	assert.Empty(t, prod.DeletedDeployment)
+}
+
+func TestErroredNoTemplatePromoteDeployment(t *testing.T) {
+	_, prod := setupPromotion()
+	setupJournal()
+
+	from, to := config.Remote{Name: "Staging"}, config.Remote{Name: "Prod"}
+	o, err := PromoteDeployment(from, to, "1", PromoteOptions{})
+	assert.EqualError(t, err, "no template was recorded for deployment '1' on 'Staging', supply one with --template")
+	assert.Equal(t, prettycli.PlainOutput{}, o)
+	assert.Empty(t, prod.DeployedBlueprint.Template.Images)
+}
+
+func TestErroredDescribePromoteDeployment(t *testing.T) {
+	staging, _ := setupPromotion()
+	staging.ErrorForDeploymentDescription = errors.New("test error")
+
+	from, to := config.Remote{Name: "Staging"}, config.Remote{Name: "Prod"}
+	_, err := PromoteDeployment(from, to, "1", PromoteOptions{})
+	assert.EqualError(t, err, "test error")
+}
+
+func setupRollback() (*FakeClient, *FakeJournal) {
+	_, prod := setupPromotion()
+	j := setupJournal()
+	j.Record(config.JournalEntry{Action: "create", Remote: "Prod", DeploymentID: 5, Name: "Wordpress with MySQL", TemplatePath: "v1.pmx"}, []byte(wordpressTemplate), []byte("images:\n- name: WP\n"))
+	j.Record(config.JournalEntry{Action: "redeploy", Remote: "Prod", DeploymentID: 6, Name: "Wordpress with MySQL", TemplatePath: "v1.pmx"}, []byte(wordpressTemplate), []byte("images:\n- name: WP\n"))
+	j.Record(config.JournalEntry{Action: "create", Remote: "Prod", DeploymentID: 8, Name: "Wordpress with MySQL", TemplatePath: "v2.pmx"}, []byte("name: Broken\n"), nil)
+	return prod, j
+}
+
+func TestRollbackDeployment(t *testing.T) {
+	prod, j := setupRollback()
+
+	o, err := RollbackDeployment(config.Remote{Name: "Prod"}, "Wordpress with MySQL", RollbackOptions{Wait: true, WaitTimeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, `Deleted deployment '8'
+Rolled back 'Wordpress with MySQL' to revision 1 as deployment '10'
+Deployment '10' is healthy`, o.ToPrettyOutput())
+
+	assert.Equal(t, "8", prod.DeletedDeployment)
+	assert.Equal(t, "Wordpress with MySQL", prod.DeployedBlueprint.Template.Name)
+	assert.Len(t, prod.DeployedBlueprint.Template.Images, 2)
+	assert.Len(t, prod.DeployedBlueprint.Override.Images, 1)
+	if assert.Len(t, j.Recorded, 5) {
+		assert.Equal(t, "delete", j.Recorded[3].Action)
+		rollback := j.Recorded[4]
+		assert.Equal(t, "rollback", rollback.Action)
+		assert.Equal(t, 10, rollback.DeploymentID)
+		assert.Equal(t, "v1.pmx", rollback.TemplatePath)
+		assert.Equal(t, j.Recorded[0].OverrideHash, rollback.OverrideHash)
+	}
+
+	revisions, err := deploymentRevisions(config.Remote{Name: "Prod"}, "Wordpress with MySQL")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 3)
+}
+
+func TestRollbackDeploymentTo(t *testing.T) {
+	prod, _ := setupRollback()
+
+	o, err := RollbackDeployment(config.Remote{Name: "Prod"}, "Wordpress with MySQL", RollbackOptions{To: 2})
+	assert.NoError(t, err)
+	assert.Contains(t, o.ToPrettyOutput(), "to revision 2 as deployment '10'")
+	assert.Empty(t, prod.DeployedBlueprint.Template.Images)
+}
+
+func TestErroredRollbackDeployment(t *testing.T) {
+	prod, _ := setupRollback()
+	prodRemote := config.Remote{Name: "Prod"}
+
+	_, err := RollbackDeployment(prodRemote, "Missing", RollbackOptions{})
+	assert.EqualError(t, err, "no revisions of 'Missing' on 'Prod' were recorded")
+	_, err = RollbackDeployment(prodRemote, "Wordpress with MySQL", RollbackOptions{To: 3})
+	assert.EqualError(t, err, "revision 3 of 'Wordpress with MySQL' does not exist, it has 2 revision(s)")
+
+	DefaultJournal.Record(config.JournalEntry{Action: "create", Remote: "Prod", Name: "Single"}, []byte("name: Single\n"), nil)
+	_, err = RollbackDeployment(prodRemote, "Single", RollbackOptions{})
+	assert.EqualError(t, err, "'Single' on 'Prod' has no earlier revision to roll back to")
+
+	prod.ErrorForDeploymentDelete = errors.New("test error")
+	_, err = RollbackDeployment(prodRemote, "Wordpress with MySQL", RollbackOptions{})
+	assert.EqualError(t, err, "test error")
+	assert.Empty(t, prod.DeployedBlueprint.Template.Name)
+}
+
+func TestUnhealthyRollbackDeployment(t *testing.T) {
+	prod, _ := setupRollback()
+	prod.DeploymentDescription = servicesInState("failed")
+
+	o, err := RollbackDeployment(config.Remote{Name: "Prod"}, "Wordpress with MySQL", RollbackOptions{Wait: true, WaitTimeout: 5 * time.Millisecond})
+	assert.EqualError(t, err, "deployment '10' was not healthy after 5ms")
+	assert.Contains(t, o.ToPrettyOutput(), "as deployment '10'")
+}
+
+func setupUpgrade(t *testing.T) (*FakeClient, *FakeJournal, string) {
+	_, prod := setupPromotion()
+	j := setupJournal()
+	j.Record(config.JournalEntry{Action: "create", Remote: "Prod", DeploymentID: 8, Name: "Wordpress with MySQL", TemplatePath: "v1.pmx", OverridePath: "prod.pmx"}, []byte("name: WP\nimages:\n- name: wp\n  source: wordpress:4.1\n"), []byte("images:\n- name: wp\n"))
+	path := setupTemplateFile(t, "name: WP\nimages:\n- name: wp\n  source: wordpress:4.2\n")
+	return prod, j, path
+}
+
+func TestUpgradeDeployment(t *testing.T) {
+	prod, j, path := setupUpgrade(t)
+	defer os.Remove(path)
+
+	o, err := UpgradeDeployment(config.Remote{Name: "Prod"}, "Wordpress with MySQL", path, UpgradeOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, `CHANGES
+  name: WP
+  images:
+  - name: wp
+-   source: wordpress:4.1
++   source: wordpress:4.2
+
+Deleted deployment '8'
+Upgraded 'Wordpress with MySQL' as deployment '10'`, o.ToPrettyOutput())
+
+	assert.Equal(t, "8", prod.DeletedDeployment)
+	assert.Equal(t, "Wordpress with MySQL", prod.DeployedBlueprint.Template.Name)
+	assert.Len(t, prod.DeployedBlueprint.Override.Images, 1)
+	if assert.Len(t, j.Recorded, 3) {
+		assert.Equal(t, "delete", j.Recorded[1].Action)
+		upgrade := j.Recorded[2]
+		assert.Equal(t, "upgrade", upgrade.Action)
+		assert.Equal(t, 10, upgrade.DeploymentID)
+		assert.Equal(t, path, upgrade.TemplatePath)
+		assert.Equal(t, "prod.pmx", upgrade.OverridePath)
+	}
+}
+
+func TestUpgradeDeploymentCreateFirst(t *testing.T) {
+	prod, _, path := setupUpgrade(t)
+	defer os.Remove(path)
+	DefaultJournal = nil
+
+	o, err := UpgradeDeployment(config.Remote{Name: "Prod"}, "8", path, UpgradeOptions{CreateFirst: true, WaitTimeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, `CHANGES
+No template was recorded for deployment '8', so there is nothing to compare with.
+
+Upgraded 'Wordpress with MySQL' as deployment '10'
+Deployment '10' is healthy
+Deleted deployment '8'`, o.ToPrettyOutput())
+	assert.Equal(t, "8", prod.DeletedDeployment)
+}
+
+func TestUnhealthyUpgradeDeploymentKeepsOld(t *testing.T) {
+	prod, _, path := setupUpgrade(t)
+	defer os.Remove(path)
+	prod.DeploymentDescription = servicesInState("failed")
+
+	o, err := UpgradeDeployment(config.Remote{Name: "Prod"}, "8", path, UpgradeOptions{CreateFirst: true, WaitTimeout: 5 * time.Millisecond})
+	assert.EqualError(t, err, "deployment '10' was not healthy after 5ms")
+	assert.Contains(t, o.ToPrettyOutput(), "as deployment '10'")
+	assert.Empty(t, prod.DeletedDeployment)
+}
+
+func TestErroredUpgradeDeployment(t *testing.T) {
+	prod, _, path := setupUpgrade(t)
+	defer os.Remove(path)
+	prod.Deployments = append(prod.Deployments, agent.DeploymentResponseLite{ID: 11, Name: "Other"})
+	r := config.Remote{Name: "Prod"}
+
+	_, err := UpgradeDeployment(r, "Missing", path, UpgradeOptions{})
+	assert.EqualError(t, err, "no deployment has the ID or name 'Missing'")
+	_, err = UpgradeDeployment(r, "Other", path, UpgradeOptions{})
+	assert.EqualError(t, err, "2 deployments are named 'Other', use an ID instead")
+	_, err = UpgradeDeployment(r, "8", "/nonexistant.pmx", UpgradeOptions{})
+	assert.Error(t, err)
+
+	prod.ErrorForDeploymentDelete = errors.New("test error")
+	_, err = UpgradeDeployment(r, "8", path, UpgradeOptions{})
+	assert.EqualError(t, err, "test error")
+	assert.Empty(t, prod.DeployedBlueprint.Template.Name)
+}
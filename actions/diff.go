@@ -0,0 +1,89 @@
+package actions
+
+import "strings"
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// diffLines compares two texts line by line and returns the changes between
+// them, prefixed with "- " for removed lines, "+ " for added lines and "  " for
+// the unchanged lines around them. Runs of unchanged lines that aren't near a
+// change are collapsed to "...". Nothing is returned when the texts match.
+func diffLines(a string, b string) []string {
+	as := splitLines(a)
+	bs := splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of as[i:] and
+	// bs[j:].
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	changed := false
+	for i, j := 0, 0; i < len(as) || j < len(bs); {
+		switch {
+		case i < len(as) && j < len(bs) && as[i] == bs[j]:
+			lines = append(lines, "  "+as[i])
+			i++
+			j++
+		case i < len(as) && (j == len(bs) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+as[i])
+			changed = true
+			i++
+		default:
+			lines = append(lines, "+ "+bs[j])
+			changed = true
+			j++
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return collapseUnchanged(lines)
+}
+
+func collapseUnchanged(lines []string) []string {
+	near := make([]bool, len(lines))
+	for i, l := range lines {
+		if strings.HasPrefix(l, "  ") {
+			continue
+		}
+		for j := i - diffContext; j <= i+diffContext; j++ {
+			if j >= 0 && j < len(lines) {
+				near[j] = true
+			}
+		}
+	}
+
+	var collapsed []string
+	for i, l := range lines {
+		if near[i] {
+			collapsed = append(collapsed, l)
+		} else if i == 0 || near[i-1] {
+			collapsed = append(collapsed, "...")
+		}
+	}
+	return collapsed
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\n"
+	b := "a\nb\nc\nd\ne\nF\ng\nh\ni\nj\n"
+
+	assert.Equal(t, []string{
+		"...",
+		"  c",
+		"  d",
+		"  e",
+		"- f",
+		"+ F",
+		"  g",
+		"  h",
+		"  i",
+		"+ j",
+	}, diffLines(a, b))
+}
+
+func TestDiffLinesCollapsesBetweenChanges(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n"
+
+	assert.Equal(t, []string{
+		"- 1",
+		"+ one",
+		"  2",
+		"  3",
+		"  4",
+		"...",
+		"  7",
+		"  8",
+		"  9",
+		"- 10",
+		"+ ten",
+	}, diffLines(a, b))
+}
+
+func TestUnchangedDiffLines(t *testing.T) {
+	assert.Nil(t, diffLines("a\nb\n", "a\nb"))
+	assert.Nil(t, diffLines("", ""))
+	assert.Equal(t, []string{"+ a"}, diffLines("", "a"))
+}
@@ -0,0 +1,271 @@
+package actions
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+)
+
+// ErrChecksFailed is returned by Doctor when any check did not pass. The
+// accompanying output explains which ones.
+var ErrChecksFailed = errors.New("one or more checks failed")
+
+// The network operations performed by Doctor are swappable so that tests
+// don't need a real agent to talk to.
+var (
+	lookupHost   = net.LookupHost
+	dialTCP      = net.DialTimeout
+	tlsHandshake = func(addr string, c *tls.Config, timeout time.Duration) error {
+		conn, err := tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, c)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+)
+
+const (
+	checkPassed  = "PASS"
+	checkFailed  = "FAIL"
+	checkSkipped = "SKIP"
+)
+
+type doctorCheck struct {
+	Name string
+	Run  func() (string, error)
+}
+
+// Doctor runs a series of diagnostic checks against the configuration file at
+// configPath and each named remote, returning a checklist of the results.
+// Checks for a remote run in order and stop at the first failure, since every
+// step depends on the one before it.
+func Doctor(c config.Config, configPath string, names []string) (prettycli.Output, error) {
+	co := prettycli.CombinedOutput{}
+	checks := configChecks(configPath)
+	if len(names) == 0 {
+		checks = append(checks, activeRemoteCheck(c))
+	}
+	lo, ok := runChecks(checks)
+	co.AddOutput("Configuration", lo)
+
+	for _, name := range names {
+		r, err := c.Get(name)
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+
+		rlo, rok := runChecks(remoteChecks(r))
+		co.AddOutput(fmt.Sprintf("Remote '%s'", r.Name), rlo)
+		ok = ok && rok
+	}
+
+	if !ok {
+		return &co, ErrChecksFailed
+	}
+	return &co, nil
+}
+
+func runChecks(checks []doctorCheck) (prettycli.ListOutput, bool) {
+	lo := prettycli.ListOutput{Labels: []string{"Check", "Result", "Detail"}}
+	failed := false
+	for _, check := range checks {
+		if failed {
+			lo.AddRow(map[string]string{
+				"Check":  check.Name,
+				"Result": checkSkipped,
+				"Detail": "previous check failed",
+			})
+			continue
+		}
+
+		detail, err := check.Run()
+		result := checkPassed
+		if err != nil {
+			result = checkFailed
+			detail = err.Error()
+			failed = true
+		}
+
+		lo.AddRow(map[string]string{
+			"Check":  check.Name,
+			"Result": result,
+			"Detail": detail,
+		})
+	}
+
+	return lo, !failed
+}
+
+func configChecks(path string) []doctorCheck {
+	var info os.FileInfo
+	return []doctorCheck{
+		{"Config file", func() (string, error) {
+			var err error
+			info, err = os.Stat(path)
+			if os.IsNotExist(err) {
+				return "not created yet, no remotes are configured", nil
+			}
+			return path, err
+		}},
+		{"Config permissions", func() (string, error) {
+			if info == nil || runtime.GOOS == "windows" {
+				return "not applicable", nil
+			}
+			if perm := info.Mode().Perm(); perm&0077 != 0 {
+				return "", fmt.Errorf("mode is %04o, it should be 0600 because it contains credentials", perm)
+			}
+			return fmt.Sprintf("%04o", info.Mode().Perm()), nil
+		}},
+		{"Config parse", func() (string, error) {
+			if info == nil {
+				return "not applicable", nil
+			}
+			fc := config.FileConfig{Path: path}
+			if err := fc.Load(); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d remote(s)", len(fc.Remotes())), nil
+		}},
+	}
+}
+
+// activeRemoteCheck fails when there is no remote to check, so that doctor
+// never reports a configuration that can't reach any agent as healthy.
+func activeRemoteCheck(c config.Config) doctorCheck {
+	return doctorCheck{"Active remote", func() (string, error) {
+		if len(c.Remotes()) == 0 {
+			return "", errors.New("no remotes are configured, add one with 'pmxcli remote add'")
+		}
+		return "", errors.New("no remote is active, set one with 'pmxcli remote active', or pass a remote name or --all")
+	}}
+}
+
+// proxyAddr returns the host and port to connect to the proxy on.
+func proxyAddr(proxy *url.URL) string {
+	if _, _, err := net.SplitHostPort(proxy.Host); err == nil {
+		return proxy.Host
+	}
+	switch proxy.Scheme {
+	case "https":
+		return net.JoinHostPort(proxy.Host, "443")
+	case "socks5":
+		return net.JoinHostPort(proxy.Host, "1080")
+	default:
+		return net.JoinHostPort(proxy.Host, "80")
+	}
+}
+
+func remoteChecks(r config.Remote) []doctorCheck {
+	timeout := remoteTimeouts(r).Read
+	var u, proxy *url.URL
+	var host, port string
+	var adapter adapterMetadata
+
+	return []doctorCheck{
+		{"Token decode", func() (string, error) {
+			decoded := config.Remote{Token: r.Token}
+			if err := decoded.DecodeToken(); err != nil {
+				return "", err
+			}
+			if decoded.Endpoint != r.Endpoint {
+				return "", fmt.Errorf("token endpoint '%s' does not match configured endpoint '%s'", decoded.Endpoint, r.Endpoint)
+			}
+
+			var err error
+			u, err = url.Parse(r.Endpoint)
+			if err != nil {
+				return "", err
+			}
+			host, port = u.Host, ""
+			if h, p, err := net.SplitHostPort(u.Host); err == nil {
+				host, port = h, p
+			}
+			if port == "" {
+				port = "443"
+				if u.Scheme == "http" {
+					port = "80"
+				}
+			}
+			if proxy, err = agentClient(r).ProxyFor(r.Endpoint); err != nil {
+				return "", err
+			}
+			return r.Endpoint, nil
+		}},
+		{"DNS resolution", func() (string, error) {
+			if net.ParseIP(host) != nil {
+				return fmt.Sprintf("%s is an IP address", host), nil
+			}
+			addrs, err := lookupHost(host)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s resolves to %v", host, addrs), nil
+		}},
+		{"TCP connect", func() (string, error) {
+			addr := net.JoinHostPort(host, port)
+			through := ""
+			if proxy != nil {
+				addr, through = proxyAddr(proxy), "the proxy "
+			}
+			start := time.Now()
+			conn, err := dialTCP("tcp", addr, timeout)
+			if err != nil {
+				return "", err
+			}
+			conn.Close()
+			return fmt.Sprintf("connected to %s%s in %s", through, addr, time.Since(start)), nil
+		}},
+		{"TLS handshake", func() (string, error) {
+			if u.Scheme != "https" {
+				return "endpoint does not use TLS", nil
+			}
+			if !x509.NewCertPool().AppendCertsFromPEM([]byte(r.PrivateKey)) {
+				return "", errors.New("the certificate in the token could not be parsed")
+			}
+			c, err := agentClient(r).TLSConfig()
+			if err != nil {
+				return "", err
+			}
+			if proxy != nil {
+				return fmt.Sprintf("checked through the proxy %s by the next step", proxy.Host), nil
+			}
+			c.ServerName = host
+			if err := tlsHandshake(net.JoinHostPort(host, port), c, timeout); err != nil {
+				return "", err
+			}
+			if client.SkipSSLVerify {
+				return "certificate verification skipped (--insecure)", nil
+			}
+			return "certificate verified", nil
+		}},
+		{"Authentication", func() (string, error) {
+			metadata, err := DefaultAgentClientFactory.New(r).GetMetadata()
+			if err != nil {
+				if rErr, ok := err.(client.RequestError); ok && rErr.StatusCode == 401 {
+					return "", errors.New("the agent rejected the token's credentials")
+				}
+				return "", err
+			}
+			if adapter, err = decodeAdapterMetadata(metadata); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("agent version %s", metadata.Agent.Version), nil
+		}},
+		{"Adapter health", func() (string, error) {
+			if !adapter.IsHealthy {
+				return "", fmt.Errorf("%s adapter %s reports that it is unhealthy", adapter.Type, adapter.Version)
+			}
+			return fmt.Sprintf("%s adapter %s is healthy", adapter.Type, adapter.Version), nil
+		}},
+	}
+}
@@ -0,0 +1,246 @@
+package actions
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+	"github.com/stretchr/testify/assert"
+)
+
+var doctorTestToken = "aHR0cHM6Ly9hZ2VudC5leGFtcGxlLmNvbTozMDAxfHVzZXJ8cGFzc3xjZXJ0"
+
+func setupDoctor() {
+	setupFactory()
+	fakeClient.Metadata = agent.Metadata{
+		Agent: agent.AgentMetadata{Version: "0.1"},
+		Adapter: map[string]interface{}{
+			"version": "0.2", "type": "Fleet", "isHealthy": true,
+		},
+	}
+	lookupHost = func(string) ([]string, error) { return []string{"10.0.0.1"}, nil }
+	dialTCP = func(string, string, time.Duration) (net.Conn, error) {
+		c, _ := net.Pipe()
+		return c, nil
+	}
+	tlsHandshake = func(string, *tls.Config, time.Duration) error { return nil }
+}
+
+func doctorRemote() config.Remote {
+	r := config.Remote{Name: "Test", Token: doctorTestToken}
+	r.DecodeToken()
+	r.PrivateKey = testCertificate
+	return r
+}
+
+func doctorConfigFile(t *testing.T, perm os.FileMode) string {
+	f, err := ioutil.TempFile("", "pmx-doctor-config")
+	assert.NoError(t, err)
+	f.WriteString(`{"remotes": []}`)
+	f.Close()
+	assert.NoError(t, os.Chmod(f.Name(), perm))
+	return f.Name()
+}
+
+func doctorRows(t *testing.T, o prettycli.Output, section int) []map[string]string {
+	co, ok := o.(*prettycli.CombinedOutput)
+	if !assert.True(t, ok) || !assert.True(t, len(co.Outputs) > section) {
+		return nil
+	}
+	lo, ok := co.Outputs[section].Output.(prettycli.ListOutput)
+	if !assert.True(t, ok) {
+		return nil
+	}
+	return lo.Rows
+}
+
+func TestSuccessfulDoctor(t *testing.T) {
+	setupDoctor()
+	path := doctorConfigFile(t, 0600)
+	defer os.Remove(path)
+	fc := FakeConfig{Agents: []config.Remote{doctorRemote()}}
+
+	o, err := Doctor(&fc, path, []string{"Test"})
+	assert.NoError(t, err)
+
+	rows := doctorRows(t, o, 0)
+	if assert.Len(t, rows, 3) {
+		for _, r := range rows {
+			assert.Equal(t, checkPassed, r["Result"], r["Check"])
+		}
+		assert.Equal(t, "0 remote(s)", rows[2]["Detail"])
+	}
+
+	rows = doctorRows(t, o, 1)
+	if assert.Len(t, rows, 6) {
+		for _, r := range rows {
+			assert.Equal(t, checkPassed, r["Result"], r["Check"])
+		}
+		assert.Equal(t, "agent.example.com resolves to [10.0.0.1]", rows[1]["Detail"])
+		assert.Equal(t, "agent version 0.1", rows[4]["Detail"])
+		assert.Equal(t, "Fleet adapter 0.2 is healthy", rows[5]["Detail"])
+	}
+}
+
+func TestMissingConfigDoctor(t *testing.T) {
+	setupDoctor()
+	fc := FakeConfig{}
+
+	o, err := Doctor(&fc, "/nonexistant/remotes", nil)
+	assert.Equal(t, ErrChecksFailed, err)
+	rows := doctorRows(t, o, 0)
+	if assert.Len(t, rows, 4) {
+		assert.Equal(t, "not created yet, no remotes are configured", rows[0]["Detail"])
+		assert.Equal(t, "not applicable", rows[2]["Detail"])
+		assert.Equal(t, checkFailed, rows[3]["Result"])
+		assert.Equal(t, "no remotes are configured, add one with 'pmxcli remote add'", rows[3]["Detail"])
+	}
+}
+
+func TestErroredNoActiveRemoteDoctor(t *testing.T) {
+	setupDoctor()
+	path := doctorConfigFile(t, 0600)
+	defer os.Remove(path)
+	fc := FakeConfig{Agents: []config.Remote{doctorRemote()}}
+
+	o, err := Doctor(&fc, path, nil)
+	assert.Equal(t, ErrChecksFailed, err)
+	rows := doctorRows(t, o, 0)
+	if assert.Len(t, rows, 4) {
+		assert.Equal(t, "Active remote", rows[3]["Check"])
+		assert.Equal(t, checkFailed, rows[3]["Result"])
+		assert.Equal(t, "no remote is active, set one with 'pmxcli remote active', or pass a remote name or --all", rows[3]["Detail"])
+	}
+}
+
+func TestErroredPermissionsDoctor(t *testing.T) {
+	setupDoctor()
+	path := doctorConfigFile(t, 0644)
+	defer os.Remove(path)
+	fc := FakeConfig{}
+
+	o, err := Doctor(&fc, path, nil)
+	assert.Equal(t, ErrChecksFailed, err)
+	rows := doctorRows(t, o, 0)
+	if assert.Len(t, rows, 4) {
+		assert.Equal(t, checkFailed, rows[1]["Result"])
+		assert.Contains(t, rows[1]["Detail"], "mode is 0644")
+		assert.Equal(t, checkSkipped, rows[2]["Result"])
+		assert.Equal(t, checkSkipped, rows[3]["Result"])
+	}
+}
+
+func TestErroredDNSDoctor(t *testing.T) {
+	setupDoctor()
+	lookupHost = func(string) ([]string, error) { return nil, errors.New("no such host") }
+	fc := FakeConfig{Agents: []config.Remote{doctorRemote()}}
+
+	o, err := Doctor(&fc, "/nonexistant/remotes", []string{"Test"})
+	assert.Equal(t, ErrChecksFailed, err)
+	rows := doctorRows(t, o, 1)
+	if assert.Len(t, rows, 6) {
+		assert.Equal(t, checkPassed, rows[0]["Result"])
+		assert.Equal(t, checkFailed, rows[1]["Result"])
+		assert.Equal(t, "no such host", rows[1]["Detail"])
+		for _, r := range rows[2:] {
+			assert.Equal(t, checkSkipped, r["Result"])
+		}
+	}
+}
+
+func TestErroredTLSDoctor(t *testing.T) {
+	setupDoctor()
+	tlsHandshake = func(string, *tls.Config, time.Duration) error {
+		return errors.New("x509: certificate signed by unknown authority")
+	}
+	fc := FakeConfig{Agents: []config.Remote{doctorRemote()}}
+
+	o, _ := Doctor(&fc, "/nonexistant/remotes", []string{"Test"})
+	rows := doctorRows(t, o, 1)
+	if assert.Len(t, rows, 6) {
+		assert.Equal(t, checkFailed, rows[3]["Result"])
+		assert.Contains(t, rows[3]["Detail"], "unknown authority")
+	}
+}
+
+func TestProxiedDoctor(t *testing.T) {
+	setupDoctor()
+	var dialed string
+	dialTCP = func(network string, addr string, timeout time.Duration) (net.Conn, error) {
+		dialed = addr
+		c, _ := net.Pipe()
+		return c, nil
+	}
+	r := doctorRemote()
+	r.Proxy = "http://proxy.example.com:3128"
+	fc := FakeConfig{Agents: []config.Remote{r}}
+
+	o, err := Doctor(&fc, "/nonexistant/remotes", []string{"Test"})
+	assert.NoError(t, err)
+	rows := doctorRows(t, o, 1)
+	if assert.Len(t, rows, 6) {
+		assert.Equal(t, "proxy.example.com:3128", dialed)
+		assert.Contains(t, rows[2]["Detail"], "connected to the proxy proxy.example.com:3128")
+		assert.Equal(t, "checked through the proxy proxy.example.com:3128 by the next step", rows[3]["Detail"])
+	}
+}
+
+func TestErroredBadCertificateDoctor(t *testing.T) {
+	setupDoctor()
+	r := doctorRemote()
+	r.PrivateKey = "cert"
+	fc := FakeConfig{Agents: []config.Remote{r}}
+
+	o, _ := Doctor(&fc, "/nonexistant/remotes", []string{"Test"})
+	rows := doctorRows(t, o, 1)
+	if assert.Len(t, rows, 6) {
+		assert.Equal(t, checkFailed, rows[3]["Result"])
+		assert.Equal(t, "the certificate in the token could not be parsed", rows[3]["Detail"])
+	}
+}
+
+func TestErroredAuthenticationDoctor(t *testing.T) {
+	setupDoctor()
+	fakeClient.ErrorForMetadata = client.RequestError{StatusCode: 401}
+	fc := FakeConfig{Agents: []config.Remote{doctorRemote()}}
+
+	o, _ := Doctor(&fc, "/nonexistant/remotes", []string{"Test"})
+	rows := doctorRows(t, o, 1)
+	if assert.Len(t, rows, 6) {
+		assert.Equal(t, checkFailed, rows[4]["Result"])
+		assert.Equal(t, "the agent rejected the token's credentials", rows[4]["Detail"])
+	}
+}
+
+func TestErroredUnhealthyAdapterDoctor(t *testing.T) {
+	setupDoctor()
+	fakeClient.Metadata.Adapter = map[string]interface{}{
+		"version": "0.2", "type": "Fleet", "isHealthy": false,
+	}
+	fc := FakeConfig{Agents: []config.Remote{doctorRemote()}}
+
+	o, err := Doctor(&fc, "/nonexistant/remotes", []string{"Test"})
+	assert.Equal(t, ErrChecksFailed, err)
+	rows := doctorRows(t, o, 1)
+	if assert.Len(t, rows, 6) {
+		assert.Equal(t, checkFailed, rows[5]["Result"])
+		assert.Equal(t, "Fleet adapter 0.2 reports that it is unhealthy", rows[5]["Detail"])
+	}
+}
+
+func TestErroredNonexistantDoctor(t *testing.T) {
+	setupDoctor()
+	fc := FakeConfig{}
+
+	o, err := Doctor(&fc, "/nonexistant/remotes", []string{"Bad"})
+	assert.EqualError(t, err, "the remote 'Bad' does not exist")
+	assert.Empty(t, o.ToPrettyOutput())
+}
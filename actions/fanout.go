@@ -0,0 +1,77 @@
+package actions
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+)
+
+// A remoteResult holds the outcome of running a function against a single
+// remote as part of a fan-out.
+type remoteResult struct {
+	Remote   config.Remote
+	Value    interface{}
+	Err      error
+	Duration time.Duration
+}
+
+// fanOut runs fn against every remote concurrently and returns the results in
+// the same order as remotes. No more than limit calls will be in flight at
+// once, unless limit is zero, and calls are started in the order of remotes.
+// When timeout is nonzero, remotes that take longer than it are abandoned and
+// reported with an error so that a single unresponsive agent can't hold up
+// the rest.
+func fanOut(remotes []config.Remote, limit int, timeout time.Duration, fn func(config.Remote) (interface{}, error)) []remoteResult {
+	results := make([]remoteResult, len(remotes))
+	if limit <= 0 || limit > len(remotes) {
+		limit = len(remotes)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < limit; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = callWithTimeout(remotes[i], timeout, fn)
+			}
+		}()
+	}
+
+	for i := range remotes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func callWithTimeout(r config.Remote, timeout time.Duration, fn func(config.Remote) (interface{}, error)) remoteResult {
+	start := time.Now()
+	done := make(chan remoteResult, 1)
+	go func() {
+		v, err := fn(r)
+		done <- remoteResult{Remote: r, Value: v, Err: err}
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		expired = time.After(timeout)
+	}
+
+	select {
+	case res := <-done:
+		res.Duration = time.Since(start)
+		return res
+	case <-expired:
+		return remoteResult{
+			Remote:   r,
+			Err:      fmt.Errorf("timed out after %s", timeout),
+			Duration: time.Since(start),
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package actions
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFanOutPreservesOrder(t *testing.T) {
+	remotes := []config.Remote{{Name: "Slow"}, {Name: "Fast"}}
+	results := fanOut(remotes, 0, 0, func(r config.Remote) (interface{}, error) {
+		if r.Name == "Slow" {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return r.Name, nil
+	})
+
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "Slow", results[0].Value)
+		assert.Equal(t, "Slow", results[0].Remote.Name)
+		assert.Equal(t, "Fast", results[1].Value)
+	}
+}
+
+func TestFanOutErrors(t *testing.T) {
+	remotes := []config.Remote{{Name: "Bad"}, {Name: "Good"}}
+	results := fanOut(remotes, 0, 0, func(r config.Remote) (interface{}, error) {
+		if r.Name == "Bad" {
+			return nil, errors.New("test error")
+		}
+		return nil, nil
+	})
+
+	assert.EqualError(t, results[0].Err, "test error")
+	assert.NoError(t, results[1].Err)
+}
+
+func TestFanOutTimeout(t *testing.T) {
+	remotes := []config.Remote{{Name: "Dead"}, {Name: "Alive"}}
+	block := make(chan struct{})
+	defer close(block)
+	results := fanOut(remotes, 0, 10*time.Millisecond, func(r config.Remote) (interface{}, error) {
+		if r.Name == "Dead" {
+			<-block
+		}
+		return nil, nil
+	})
+
+	assert.EqualError(t, results[0].Err, "timed out after 10ms")
+	assert.NoError(t, results[1].Err)
+}
+
+func TestFanOutLimit(t *testing.T) {
+	remotes := []config.Remote{{Name: "1"}, {Name: "2"}, {Name: "3"}, {Name: "4"}}
+	var mutex sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	fanOut(remotes, 2, 0, func(r config.Remote) (interface{}, error) {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+		return nil, nil
+	})
+
+	assert.Equal(t, 2, maxInFlight)
+}
@@ -46,3 +46,32 @@ images:
   category: DB Tier
   type: mysql
 `
+
+var testCertificate = `-----BEGIN CERTIFICATE-----
+MIIErDCCApQCCQD8k0Hebkan8jANBgkqhkiG9w0BAQUFADAYMRYwFAYDVQQDDA00
+NS41NS4xNTIuMjAxMB4XDTE1MDMyNzE4NTIwOVoXDTE2MDMyNjE4NTIwOVowGDEW
+MBQGA1UEAwwNNDUuNTUuMTUyLjIwMTCCAiIwDQYJKoZIhvcNAQEBBQADggIPADCC
+AgoCggIBAN7PKiC67jDHspnk6gxMvBOgNBLEbKbwVU9SgH3yPKP+FQUW/VP/kS1s
+EINXXEF6d6yYezscZY633LOCPyejqGc0Yg/zwMgZMpuzaJrGafT0n/Fp5W/gbn/J
+E8pJtmMSBt/uMzRqQcAXZrUKfNvIi+OPYbVJ5HQMY7cS74nXtmJV/C2hUI0rH7Ty
+Tvu0Ng/hFZfb1itA8k3lIRjty+ykY0MyFjIkzeaRN4cse71ZpbmX1o1xAQDLJNFz
+I7NfXs2KEpdWDV5f7RE8kiV4CwX/EiT4saQ8v84AB70ttNVOnBfKyPfv+nCUAAK5
+FiTk4WvIIiKH2JW8mnjnXe/NNwdhHbOUA8iph9ucozMM9SxoDeTiL/3xH8BPwaPf
+O1HUEj3MmRBMlkDtxvFo3l+n5rj3crU+ULeMPVrJNRtfDFfReKjLlxyQcaZ5kI0q
+aTCECs+P8wKvQah4wUGwZX5rvHtxnExaUv4iC5BePkgV9dIhm7PTRPCI4+ZwwD0P
+LFiVgFf5j2ivDC3z1ZOxn8K/dRl+fg7oA57W6cs0QlfGyDk13VjFyOJjep+EC5V9
+xeqmuEoLtCOkRyia7Pl3GpCknUNalRNnoyHmDYrMSpZHtNRyB6QpNfbFqBu0sg5n
+tBx4Ka3hDrcBuUtQlzgJBf1Q5IUMqYSspH3EQlYIc49x4365Efb7AgMBAAEwDQYJ
+KoZIhvcNAQEFBQADggIBAGv7Z4+BJpet0JpW0MhfZ5Cfgh/pJxSjLJBmEt43V++H
+X7THWgpBDvvAXRS4hcM5vl0b4mD2wG6fO+7gIZmeidI6PyKzyUIPk7CeS9PSYjDx
+dENywhojVWd3ozuBfKr0y0EmCRjwSqcSZmgSAtp1YJxO7nlN7qxnyMZ//o7tG4Og
+6y4MdmW5aDvcUAvuho+JAxRKKfNP3otBG9jSs4pCBnu/FexGyUXTh/II/bAj+1KE
+l4ht/tESRoMdFQ7wk2Zsapuy+o6Ist4qVtXSVlSAu+XojpuiVl6eaeimAJ3LBQ1w
+5Igs9lRsZdBNGf7I9jl5MfwE1DTo9g0/mq4FqDNduUIbMhtYQZqtHDUb57nLj4tb
+mUSULoZRNlK2rMDRFXC0DV1NFEZ50R3AriuWU+Bja7XyOzZAVUfDZQNj8ns8LGrR
+zBMyUXFHmZB6ku4sDsq0Zq5rz8Dq7uHoqLNkFQ3NhgZs4H/dkYDqQjikcKZREfDn
+/SI+IoMnFn1KjhW1yBgrEvCk70LIhQLxgjRYP57UxZDHD1PkUXGcVxSyxtHchr0o
+ysIbBYdZ7FE1NAqMNk0GU4M0wEFezLFEheDOMbwZmzO/dliY3NA9tV78y0p2bAhB
+FHYD6WpHY3gUIEruTV4kZKM2NRub9UG+ljSc/bP98zbC+DZ7jMnkkNGlvf6pTd3g
+-----END CERTIFICATE-----
+`
@@ -0,0 +1,141 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamaxcli/template"
+	"github.com/CenturyLinkLabs/prettycli"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatOptions controls what FormatTemplates does with the formatted
+// templates. By default they're output rather than written anywhere.
+type FormatOptions struct {
+	// Write rewrites each file that isn't already formatted.
+	Write bool
+	// Force writes files even though formatting removes their comments.
+	// Without it, Write refuses to change any file if one has comments.
+	Force bool
+	// Check lists each file that isn't formatted, without changing it, and
+	// fails if there are any.
+	Check bool
+	// SortImages orders images by name rather than keeping them as written.
+	SortImages bool
+}
+
+// FormatTemplates puts the templates at the paths in a canonical form: fields
+// in a fixed order, numbers such as ports written as integers rather than
+// strings, and consistent indentation. YAML comments aren't kept, so files
+// with comments are only written with Force.
+func FormatTemplates(paths []string, opts FormatOptions) (prettycli.Output, error) {
+	var formatted []string
+	var lines []string
+	var writes []formattedFile
+	var commented []string
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		f, err := formatTemplate(b, opts.SortImages)
+		if err != nil {
+			return prettycli.PlainOutput{}, fmt.Errorf("'%s': %s", path, err)
+		}
+
+		switch {
+		case opts.Check:
+			if !bytes.Equal(b, f) {
+				lines = append(lines, path)
+			}
+		case opts.Write:
+			if bytes.Equal(b, f) {
+				continue
+			}
+			comments, err := hasComments(b)
+			if err != nil {
+				return prettycli.PlainOutput{}, fmt.Errorf("'%s': %s", path, err)
+			}
+			if comments {
+				commented = append(commented, path)
+			}
+			writes = append(writes, formattedFile{path, f})
+		default:
+			formatted = append(formatted, strings.TrimRight(string(f), "\n"))
+		}
+	}
+
+	if len(commented) > 0 && !opts.Force {
+		return prettycli.PlainOutput{}, fmt.Errorf("formatting would remove the comments in '%s', use --force to write them anyway", strings.Join(commented, "', '"))
+	}
+	for _, w := range writes {
+		info, err := os.Stat(w.path)
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		if err := ioutil.WriteFile(w.path, w.content, info.Mode()); err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		lines = append(lines, fmt.Sprintf("Formatted '%s'", w.path))
+	}
+
+	if opts.Check && len(lines) > 0 {
+		return prettycli.PlainOutput{strings.Join(lines, "\n")}, fmt.Errorf("%d template(s) are not formatted", len(lines))
+	}
+	if len(formatted) > 0 {
+		return prettycli.PlainOutput{strings.Join(formatted, "\n---\n")}, nil
+	}
+	return prettycli.PlainOutput{strings.Join(lines, "\n")}, nil
+}
+
+// A formattedFile is a template that FormatTemplates writes once every
+// template has been formatted.
+type formattedFile struct {
+	path    string
+	content []byte
+}
+
+func formatTemplate(b []byte, sortImages bool) ([]byte, error) {
+	t, err := template.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+	if sortImages {
+		sort.Stable(imagesByNameOrder(t.Images))
+	}
+	return t.Marshal()
+}
+
+// hasComments is true when the template has YAML comments, whole-line or
+// trailing. It uses the YAML parser, so text in block scalars that happens to
+// start with "#", such as headings in the documentation, isn't mistaken for
+// a comment.
+func hasComments(b []byte) (bool, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return false, err
+	}
+	return nodeHasComments(&doc), nil
+}
+
+func nodeHasComments(n *yaml.Node) bool {
+	if n.HeadComment != "" || n.LineComment != "" || n.FootComment != "" {
+		return true
+	}
+	for _, c := range n.Content {
+		if nodeHasComments(c) {
+			return true
+		}
+	}
+	return false
+}
+
+type imagesByNameOrder []template.Image
+
+func (s imagesByNameOrder) Len() int           { return len(s) }
+func (s imagesByNameOrder) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s imagesByNameOrder) Less(i, j int) bool { return s[i].Name < s[j].Name }
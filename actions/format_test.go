@@ -0,0 +1,115 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var unformattedTemplate = `images:
+- name: web
+  ports:
+    - container_port: "80"
+      host_port: '8080'
+  source: nginx
+- source: redis
+  name: cache
+name: Test
+`
+
+var formattedTemplate = `name: Test
+images:
+- name: web
+  source: nginx
+  ports:
+  - host_port: 8080
+    container_port: 80
+- name: cache
+  source: redis
+`
+
+func TestFormatTemplates(t *testing.T) {
+	path := setupTemplateFile(t, unformattedTemplate)
+	defer os.Remove(path)
+
+	o, err := FormatTemplates([]string{path}, FormatOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, formattedTemplate[:len(formattedTemplate)-1], o.ToPrettyOutput())
+
+	o, err = FormatTemplates([]string{path}, FormatOptions{Check: true})
+	assert.EqualError(t, err, "1 template(s) are not formatted")
+	assert.Equal(t, path, o.ToPrettyOutput())
+
+	o, err = FormatTemplates([]string{path}, FormatOptions{Write: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "Formatted '"+path+"'", o.ToPrettyOutput())
+	b, _ := ioutil.ReadFile(path)
+	assert.Equal(t, formattedTemplate, string(b))
+
+	o, err = FormatTemplates([]string{path}, FormatOptions{Check: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "", o.ToPrettyOutput())
+	o, err = FormatTemplates([]string{path}, FormatOptions{Write: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "", o.ToPrettyOutput())
+}
+
+func TestFormatTemplatesSortImages(t *testing.T) {
+	path := setupTemplateFile(t, formattedTemplate)
+	defer os.Remove(path)
+
+	o, err := FormatTemplates([]string{path}, FormatOptions{SortImages: true})
+	assert.NoError(t, err)
+	assert.Contains(t, o.ToPrettyOutput(), "images:\n- name: cache\n")
+
+	_, err = FormatTemplates([]string{path}, FormatOptions{Check: true, SortImages: true})
+	assert.EqualError(t, err, "1 template(s) are not formatted")
+}
+
+func TestFormatTemplatesWithComments(t *testing.T) {
+	path := setupTemplateFile(t, "# The stack\n"+unformattedTemplate)
+	defer os.Remove(path)
+	other := setupTemplateFile(t, unformattedTemplate)
+	defer os.Remove(other)
+
+	_, err := FormatTemplates([]string{other, path}, FormatOptions{Write: true})
+	assert.EqualError(t, err, "formatting would remove the comments in '"+path+"', use --force to write them anyway")
+	b, _ := ioutil.ReadFile(other)
+	assert.Equal(t, unformattedTemplate, string(b))
+
+	o, err := FormatTemplates([]string{other, path}, FormatOptions{Write: true, Force: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "Formatted '"+other+"'\nFormatted '"+path+"'", o.ToPrettyOutput())
+	b, _ = ioutil.ReadFile(path)
+	assert.Equal(t, formattedTemplate, string(b))
+}
+
+func TestFormatTemplatesCommentDetection(t *testing.T) {
+	documented := unformattedTemplate + "documentation: |\n  # Test\n\n  ## Usage\n"
+	trailing := strings.Replace(unformattedTemplate, "source: nginx", "source: nginx # pinned", 1)
+	for content, comments := range map[string]bool{documented: false, trailing: true} {
+		path := setupTemplateFile(t, content)
+		defer os.Remove(path)
+
+		o, err := FormatTemplates([]string{path}, FormatOptions{Write: true})
+		if comments {
+			assert.EqualError(t, err, "formatting would remove the comments in '"+path+"', use --force to write them anyway")
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, "Formatted '"+path+"'", o.ToPrettyOutput())
+		}
+	}
+}
+
+func TestErroredFormatTemplates(t *testing.T) {
+	path := setupTemplateFile(t, "name: [")
+	defer os.Remove(path)
+
+	_, err := FormatTemplates([]string{path}, FormatOptions{})
+	assert.Contains(t, err.Error(), "'"+path+"': ")
+	_, err = FormatTemplates([]string{"/nonexistant.pmx"}, FormatOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,420 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+)
+
+// The formats that a service graph can be output in.
+const (
+	GraphFormatTree    = "tree"
+	GraphFormatDOT     = "dot"
+	GraphFormatMermaid = "mermaid"
+)
+
+// A serviceGraph is the images in a template, connected by their links and
+// the volumes they share.
+type serviceGraph struct {
+	Name  string
+	Nodes []string
+	// States, when set, holds the state of each image's services in a live
+	// deployment.
+	States map[string]string
+	Edges  []graphEdge
+}
+
+// A graphEdge points from an image to an image it depends on.
+type graphEdge struct {
+	From        string
+	To          string
+	Alias       string
+	VolumesFrom bool
+}
+
+func (e graphEdge) label() string {
+	if e.VolumesFrom {
+		return "volumes from"
+	}
+	if e.Alias != "" && e.Alias != e.To {
+		return "link as " + e.Alias
+	}
+	return "link"
+}
+
+func buildGraph(t agent.Template) serviceGraph {
+	g := serviceGraph{Name: t.Name}
+	for _, i := range t.Images {
+		g.Nodes = append(g.Nodes, i.Name)
+		for _, l := range i.Links {
+			g.Edges = append(g.Edges, graphEdge{From: i.Name, To: l.Service, Alias: l.Alias})
+		}
+		for _, v := range i.VolumesFrom {
+			g.Edges = append(g.Edges, graphEdge{From: i.Name, To: v, VolumesFrom: true})
+		}
+	}
+	return g
+}
+
+func (g serviceGraph) hasNode(name string) bool {
+	for _, n := range g.Nodes {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (g serviceGraph) edgesFrom(name string) []graphEdge {
+	var edges []graphEdge
+	for _, e := range g.Edges {
+		if e.From == name {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// dangling returns the edges that point at images that aren't in the graph.
+func (g serviceGraph) dangling() []graphEdge {
+	var edges []graphEdge
+	for _, e := range g.Edges {
+		if !g.hasNode(e.To) {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// cycles returns each cycle of dependencies in the graph, as the images in
+// the cycle with the first repeated at the end.
+func (g serviceGraph) cycles() [][]string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var cycles [][]string
+
+	var visit func(n string)
+	visit = func(n string) {
+		state[n] = visiting
+		path = append(path, n)
+		for _, e := range g.edgesFrom(n) {
+			if !g.hasNode(e.To) {
+				continue
+			}
+			switch state[e.To] {
+			case unvisited:
+				visit(e.To)
+			case visiting:
+				for i := range path {
+					if path[i] == e.To {
+						cycle := append([]string{}, path[i:]...)
+						cycles = append(cycles, append(cycle, e.To))
+						break
+					}
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+	}
+
+	for _, n := range g.Nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return cycles
+}
+
+// startOrder lists the images so that each one comes after the images it
+// depends on. Images in a cycle can't be ordered, so they come last.
+func (g serviceGraph) startOrder() []string {
+	started := make(map[string]bool)
+	var order []string
+	for len(order) < len(g.Nodes) {
+		progress := false
+		for _, n := range g.Nodes {
+			if started[n] {
+				continue
+			}
+			ready := true
+			for _, e := range g.edgesFrom(n) {
+				ready = ready && (started[e.To] || !g.hasNode(e.To))
+			}
+			if ready {
+				started[n] = true
+				order = append(order, n)
+				progress = true
+			}
+		}
+
+		if !progress {
+			for _, n := range g.Nodes {
+				if !started[n] {
+					order = append(order, n)
+				}
+			}
+			break
+		}
+	}
+	return order
+}
+
+func (g serviceGraph) nodeLabel(name string) string {
+	if s, ok := g.States[name]; ok {
+		return fmt.Sprintf("%s [%s]", name, s)
+	}
+	return name
+}
+
+func (g serviceGraph) dot() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(g.Name))
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s];\n", strconv.Quote(n), strconv.Quote(g.nodeLabel(n)))
+	}
+	for _, e := range g.dangling() {
+		fmt.Fprintf(&b, "  %s [style=dashed, color=red];\n", strconv.Quote(e.To))
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.VolumesFrom {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "  %s -> %s [label=%s%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.label()), style)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+func (g serviceGraph) mermaid() string {
+	// Mermaid IDs can't contain most punctuation, so nodes are numbered and
+	// their names are used as labels.
+	ids := make(map[string]string)
+	id := func(name string) string {
+		if _, ok := ids[name]; !ok {
+			ids[name] = fmt.Sprintf("n%d", len(ids))
+		}
+		return ids[name]
+	}
+
+	var b bytes.Buffer
+	b.WriteString("graph TD\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", id(n), mermaidEscape(g.nodeLabel(n)))
+	}
+	for _, e := range g.dangling() {
+		fmt.Fprintf(&b, "  %s[\"%s (missing)\"]\n", id(e.To), mermaidEscape(e.To))
+	}
+	for _, e := range g.Edges {
+		arrow := "-->"
+		if e.VolumesFrom {
+			arrow = "-.->"
+		}
+		fmt.Fprintf(&b, "  %s %s|%s| %s\n", id(e.From), arrow, mermaidEscape(e.label()), id(e.To))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;").Replace(s)
+}
+
+// tree draws each image that nothing depends on, followed by the images it
+// depends on beneath it.
+func (g serviceGraph) tree() string {
+	depended := make(map[string]bool)
+	for _, e := range g.Edges {
+		depended[e.To] = true
+	}
+
+	var b bytes.Buffer
+	drawn := make(map[string]bool)
+	var draw func(name string, prefix string, path map[string]bool)
+	draw = func(name string, prefix string, path map[string]bool) {
+		drawn[name] = true
+		path[name] = true
+		edges := g.edgesFrom(name)
+		for i, e := range edges {
+			branch, indent := "|-- ", "|   "
+			if i == len(edges)-1 {
+				branch, indent = "`-- ", "    "
+			}
+
+			suffix := ""
+			switch {
+			case !g.hasNode(e.To):
+				suffix = ", missing"
+			case path[e.To]:
+				suffix = ", cycle"
+			}
+			fmt.Fprintf(&b, "%s%s%s (%s%s)\n", prefix, branch, g.nodeLabel(e.To), e.label(), suffix)
+			if suffix == "" {
+				draw(e.To, prefix+indent, path)
+			}
+		}
+		delete(path, name)
+	}
+
+	roots := []string{}
+	for _, n := range g.Nodes {
+		if !depended[n] {
+			roots = append(roots, n)
+		}
+	}
+	for _, n := range roots {
+		fmt.Fprintln(&b, g.nodeLabel(n))
+		draw(n, "", make(map[string]bool))
+	}
+	// Images that are only reachable through a cycle have no root, so they're
+	// drawn on their own.
+	for _, n := range g.Nodes {
+		if !drawn[n] {
+			fmt.Fprintln(&b, g.nodeLabel(n))
+			draw(n, "", make(map[string]bool))
+		}
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// problems describes the dangling links and cycles in the graph.
+func (g serviceGraph) problems() []string {
+	var problems []string
+	for _, e := range g.dangling() {
+		kind := "links to"
+		if e.VolumesFrom {
+			kind = "uses volumes from"
+		}
+		problems = append(problems, fmt.Sprintf("'%s' %s '%s', which is not in the template", e.From, kind, e.To))
+	}
+	for _, c := range g.cycles() {
+		problems = append(problems, fmt.Sprintf("Dependency cycle: %s", strings.Join(c, " -> ")))
+	}
+	return problems
+}
+
+// graphOutput renders the graph in the format. The tree format includes the
+// start order and any problems with the graph, while the others are left
+// untouched so that they can be piped into other tools, and the problems are
+// named in the error instead. An error is returned alongside the output
+// whenever there are problems.
+func graphOutput(g serviceGraph, format string) (prettycli.Output, error) {
+	problems := g.problems()
+
+	var o prettycli.Output
+	switch format {
+	case GraphFormatTree, "":
+		co := prettycli.CombinedOutput{}
+		co.AddOutput("", prettycli.PlainOutput{g.tree()})
+		var order []string
+		for i, n := range g.startOrder() {
+			order = append(order, fmt.Sprintf("%d. %s", i+1, n))
+		}
+		co.AddOutput("Start Order", prettycli.PlainOutput{strings.Join(order, "\n")})
+		if len(problems) > 0 {
+			co.AddOutput("Problems", prettycli.PlainOutput{strings.Join(problems, "\n")})
+		}
+		o = &co
+	case GraphFormatDOT:
+		o = prettycli.PlainOutput{g.dot()}
+	case GraphFormatMermaid:
+		o = prettycli.PlainOutput{g.mermaid()}
+	default:
+		return prettycli.PlainOutput{}, fmt.Errorf("unknown graph format '%s', use %s, %s or %s", format, GraphFormatTree, GraphFormatDOT, GraphFormatMermaid)
+	}
+
+	if len(problems) == 0 {
+		return o, nil
+	}
+	if format != GraphFormatTree && format != "" {
+		// The graph is meant to be piped to another tool, so the problems go
+		// in the error rather than the output.
+		return o, fmt.Errorf("the template has %d problem(s): %s", len(problems), strings.Join(problems, "; "))
+	}
+	return o, fmt.Errorf("the template has %d problem(s)", len(problems))
+}
+
+// TemplateGraph shows how the images in the template at path depend on each
+// other through their links and shared volumes.
+func TemplateGraph(path string, format string) (prettycli.Output, error) {
+	var t agent.Template
+	if err := readTemplate(path, &t); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	return graphOutput(buildGraph(t), format)
+}
+
+// DeploymentGraph shows the graph of the template that the deployment with the
+// given ID was created from, with the state of each image's services.
+func DeploymentGraph(remote config.Remote, id string, format string) (prettycli.Output, error) {
+	desc, err := DefaultAgentClientFactory.New(remote).DescribeDeployment(id)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	b, _, found, err := recordedTemplate(remote, desc.ID)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if !found {
+		return prettycli.PlainOutput{}, fmt.Errorf("no template was recorded for deployment '%s' on '%s'", id, remote.Name)
+	}
+	var t agent.Template
+	if err := parseTemplate(b, &t); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	g := buildGraph(t)
+	states := make(map[string][]string)
+	for _, s := range desc.Status.Services {
+		name := serviceImageName(s.ID)
+		states[name] = append(states[name], shortServiceState(s.ActualState))
+	}
+	g.States = make(map[string]string)
+	for _, n := range g.Nodes {
+		if s, ok := states[n]; ok {
+			g.States[n] = strings.Join(s, ", ")
+		} else {
+			g.States[n] = "no service"
+		}
+	}
+
+	return graphOutput(g, format)
+}
+
+// serviceImageName finds the image that a service was created from. Adapters
+// name services after their image, but may add an instance number and a
+// suffix, as Fleet does with "wp@1.service".
+func serviceImageName(id string) string {
+	id = strings.TrimSuffix(id, ".service")
+	if i := strings.Index(id, "@"); i >= 0 {
+		id = id[:i]
+	}
+	return id
+}
+
+// shortServiceState picks the most useful part of a service's state. Fleet's
+// look like "load_state: loaded; active_state: active; sub_state: running".
+func shortServiceState(state string) string {
+	const prefix = "sub_state: "
+	if i := strings.Index(state, prefix); i >= 0 {
+		s := state[i+len(prefix):]
+		if j := strings.Index(s, ";"); j >= 0 {
+			s = s[:j]
+		}
+		return strings.TrimSpace(s)
+	}
+	return state
+}
@@ -0,0 +1,157 @@
+package actions
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+	"github.com/stretchr/testify/assert"
+)
+
+var graphTemplate = `
+name: Stack
+images:
+- name: web
+  links:
+  - service: api
+    alias: backend
+  - service: cache
+- name: api
+  links:
+  - service: db
+  volumes_from:
+  - data
+- name: db
+- name: data
+- name: cache
+`
+
+var brokenGraphTemplate = `
+name: Broken
+images:
+- name: a
+  links:
+  - service: b
+- name: b
+  links:
+  - service: a
+  - service: missing
+`
+
+func TestTemplateGraphTree(t *testing.T) {
+	path := setupTemplateFile(t, graphTemplate)
+	defer os.Remove(path)
+
+	o, err := TemplateGraph(path, GraphFormatTree)
+	assert.NoError(t, err)
+	assert.Equal(t, "web\n"+
+		"|-- api (link as backend)\n"+
+		"|   |-- db (link)\n"+
+		"|   `-- data (volumes from)\n"+
+		"`-- cache (link)\n"+
+		"\n"+
+		"START ORDER\n"+
+		"1. db\n"+
+		"2. data\n"+
+		"3. cache\n"+
+		"4. api\n"+
+		"5. web", o.ToPrettyOutput())
+}
+
+func TestTemplateGraphDOT(t *testing.T) {
+	path := setupTemplateFile(t, graphTemplate)
+	defer os.Remove(path)
+
+	o, err := TemplateGraph(path, GraphFormatDOT)
+	assert.NoError(t, err)
+	s := o.ToPrettyOutput()
+	assert.Contains(t, s, `digraph "Stack" {`)
+	assert.Contains(t, s, `  "web" [label="web"];`)
+	assert.Contains(t, s, `  "web" -> "api" [label="link as backend"];`)
+	assert.Contains(t, s, `  "api" -> "data" [label="volumes from", style=dashed];`)
+}
+
+func TestTemplateGraphMermaid(t *testing.T) {
+	path := setupTemplateFile(t, graphTemplate)
+	defer os.Remove(path)
+
+	o, err := TemplateGraph(path, GraphFormatMermaid)
+	assert.NoError(t, err)
+	s := o.ToPrettyOutput()
+	assert.Contains(t, s, "graph TD\n  n0[\"web\"]\n  n1[\"api\"]")
+	assert.Contains(t, s, "  n0 -->|link as backend| n1")
+	assert.Contains(t, s, "  n1 -.->|volumes from| n3")
+}
+
+func TestTemplateGraphProblems(t *testing.T) {
+	path := setupTemplateFile(t, brokenGraphTemplate)
+	defer os.Remove(path)
+
+	o, err := TemplateGraph(path, GraphFormatTree)
+	assert.EqualError(t, err, "the template has 2 problem(s)")
+	assert.Equal(t, "a\n"+
+		"`-- b (link)\n"+
+		"    |-- a (link, cycle)\n"+
+		"    `-- missing (link, missing)\n"+
+		"\n"+
+		"START ORDER\n"+
+		"1. a\n"+
+		"2. b\n"+
+		"\n"+
+		"PROBLEMS\n"+
+		"'b' links to 'missing', which is not in the template\n"+
+		"Dependency cycle: a -> b -> a", o.ToPrettyOutput())
+
+	o, err = TemplateGraph(path, GraphFormatDOT)
+	assert.EqualError(t, err, "the template has 2 problem(s): 'b' links to 'missing', which is not in the template; Dependency cycle: a -> b -> a")
+	assert.Contains(t, o.ToPrettyOutput(), `"missing" [style=dashed, color=red];`)
+}
+
+func TestErroredTemplateGraph(t *testing.T) {
+	path := setupTemplateFile(t, graphTemplate)
+	defer os.Remove(path)
+
+	o, err := TemplateGraph(path, "svg")
+	assert.EqualError(t, err, "unknown graph format 'svg', use tree, dot or mermaid")
+	assert.Equal(t, prettycli.PlainOutput{}, o)
+
+	_, err = TemplateGraph("/nonexistant.pmx", GraphFormatTree)
+	assert.Error(t, err)
+}
+
+func TestDeploymentGraph(t *testing.T) {
+	setupFactory()
+	j := setupJournal()
+	j.Record(config.JournalEntry{Remote: "Test", DeploymentID: 1}, []byte(graphTemplate), nil)
+	fakeClient.DeploymentDescription = agent.DeploymentResponseFull{
+		ID: 1,
+		Status: agent.Status{Services: []agent.Service{
+			{ID: "web@1.service", ActualState: "load_state: loaded; active_state: active; sub_state: running"},
+			{ID: "web@2.service", ActualState: "load_state: loaded; active_state: failed; sub_state: failed"},
+			{ID: "api.service", ActualState: "running"},
+		}},
+	}
+
+	o, err := DeploymentGraph(config.Remote{Name: "Test"}, "1", GraphFormatTree)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", fakeClient.DescribedDeployment)
+	s := o.ToPrettyOutput()
+	assert.Contains(t, s, "web [running, failed]\n|-- api [running] (link as backend)\n")
+	assert.Contains(t, s, "db [no service] (link)")
+}
+
+func TestErroredDeploymentGraph(t *testing.T) {
+	setupFactory()
+	setupJournal()
+	fakeClient.DeploymentDescription = agent.DeploymentResponseFull{ID: 1}
+
+	_, err := DeploymentGraph(config.Remote{Name: "Test"}, "1", GraphFormatTree)
+	assert.EqualError(t, err, "no template was recorded for deployment '1' on 'Test'")
+
+	fakeClient.ErrorForDeploymentDescription = errors.New("test error")
+	_, err = DeploymentGraph(config.Remote{Name: "Test"}, "1", GraphFormatTree)
+	assert.EqualError(t, err, "test error")
+}
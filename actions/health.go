@@ -0,0 +1,52 @@
+package actions
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+)
+
+// healthPollInterval is how often waitForHealthy checks on a deployment.
+var healthPollInterval = 2 * time.Second
+
+// waitForHealthy polls the deployment until all of its services are running,
+// giving up after timeout.
+func waitForHealthy(c client.Client, id int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		desc, err := c.DescribeDeployment(strconv.Itoa(id))
+		if err != nil {
+			return err
+		}
+		if deploymentIsHealthy(desc) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("deployment '%d' was not healthy after %s", id, timeout)
+		}
+		time.Sleep(healthPollInterval)
+	}
+}
+
+// deploymentIsHealthy is true when every service reports that it is running.
+// Adapters describe state differently: Fleet's looks like "load_state:
+// loaded; active_state: active; sub_state: running", while others simply say
+// "running".
+func deploymentIsHealthy(desc agent.DeploymentResponseFull) bool {
+	if len(desc.Status.Services) == 0 {
+		return false
+	}
+
+	for _, s := range desc.Status.Services {
+		state := strings.ToLower(s.ActualState)
+		if !strings.Contains(state, "running") || strings.Contains(state, "failed") {
+			return false
+		}
+	}
+	return true
+}
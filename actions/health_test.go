@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+func servicesInState(states ...string) agent.DeploymentResponseFull {
+	desc := agent.DeploymentResponseFull{}
+	for _, s := range states {
+		desc.Status.Services = append(desc.Status.Services, agent.Service{ActualState: s})
+	}
+	return desc
+}
+
+func TestDeploymentIsHealthy(t *testing.T) {
+	fleetRunning := "load_state: loaded; active_state: active; sub_state: running"
+	fleetStarting := "load_state: loaded; active_state: activating; sub_state: start-pre"
+
+	assert.True(t, deploymentIsHealthy(servicesInState("running")))
+	assert.True(t, deploymentIsHealthy(servicesInState(fleetRunning, "Running")))
+	assert.False(t, deploymentIsHealthy(servicesInState(fleetRunning, fleetStarting)))
+	assert.False(t, deploymentIsHealthy(servicesInState("failed (was running)")))
+	assert.False(t, deploymentIsHealthy(servicesInState()))
+}
+
+func TestWaitForHealthy(t *testing.T) {
+	setupFactory()
+	fakeClient.DeploymentDescription = servicesInState("running")
+	assert.NoError(t, waitForHealthy(&fakeClient, 4, time.Second))
+	assert.Equal(t, "4", fakeClient.DescribedDeployment)
+}
+
+func TestTimedOutWaitForHealthy(t *testing.T) {
+	setupFactory()
+	healthPollInterval = time.Millisecond
+	fakeClient.DeploymentDescription = servicesInState("pending")
+	err := waitForHealthy(&fakeClient, 4, 5*time.Millisecond)
+	assert.EqualError(t, err, "deployment '4' was not healthy after 5ms")
+}
+
+func TestErroredWaitForHealthy(t *testing.T) {
+	setupFactory()
+	fakeClient.ErrorForDeploymentDescription = errors.New("test error")
+	assert.EqualError(t, waitForHealthy(&fakeClient, 4, time.Second), "test error")
+}
@@ -0,0 +1,268 @@
+package actions
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+)
+
+// DefaultJournal records the deployments made by actions. Nothing is recorded
+// when it is nil.
+var DefaultJournal config.Journal
+
+// A templateSource is the template, and optional override template, that a
+// deployment is created from, along with the paths they were read from.
+type templateSource struct {
+	Path         string
+	Template     []byte
+	OverridePath string
+	Override     []byte
+}
+
+func (s templateSource) blueprint() (agent.DeploymentBlueprint, error) {
+	bp := agent.DeploymentBlueprint{}
+	if err := parseTemplate(s.Template, &bp.Template); err != nil {
+		return bp, err
+	}
+	if s.Override != nil {
+		if err := parseTemplate(s.Override, &bp.Override); err != nil {
+			return bp, err
+		}
+	}
+	return bp, nil
+}
+
+// recordEntry adds an entry to DefaultJournal. The change has already happened
+// by the time this is called, so failing to record it is only worth a
+// warning.
+func recordEntry(e config.JournalEntry, template []byte, override []byte) {
+	if DefaultJournal == nil {
+		return
+	}
+
+	e.Time = time.Now().UTC()
+	e.User = currentUser()
+	if err := DefaultJournal.Record(e, template, override); err != nil {
+		warnf("the deployment could not be recorded in the local journal: %s", err)
+	}
+}
+
+func recordCreate(r config.Remote, dr agent.DeploymentResponseLite, src templateSource) {
+	recordDeployed("create", r, dr, src)
+}
+
+// recordDeployed records that dr was deployed from src by the action.
+func recordDeployed(action string, r config.Remote, dr agent.DeploymentResponseLite, src templateSource) {
+	e := config.JournalEntry{
+		Action:       action,
+		Remote:       r.Name,
+		DeploymentID: dr.ID,
+		Name:         dr.Name,
+		TemplatePath: src.Path,
+		OverridePath: src.OverridePath,
+	}
+	recordEntry(e, src.Template, src.Override)
+}
+
+// recordRedeploy records that the deployment with previousID was redeployed
+// as dr. The agent redeploys the original template, so the new entry carries
+// over whatever was recorded about it.
+func recordRedeploy(r config.Remote, previousID int, dr agent.DeploymentResponseLite) {
+	e, _, _ := latestEntry(r, previousID)
+	e.Action = "redeploy"
+	e.Remote = r.Name
+	e.DeploymentID = dr.ID
+	e.PreviousID = previousID
+	e.Name = dr.Name
+	recordEntry(e, nil, nil)
+}
+
+func recordDelete(r config.Remote, id int) {
+	e, _, _ := latestEntry(r, id)
+	e.Action = "delete"
+	e.Remote = r.Name
+	e.DeploymentID = id
+	e.PreviousID = 0
+	recordEntry(e, nil, nil)
+}
+
+// latestEntry finds the most recent entry for the deployment with the given ID
+// on the remote.
+func latestEntry(r config.Remote, id int) (config.JournalEntry, bool, error) {
+	if DefaultJournal == nil {
+		return config.JournalEntry{}, false, nil
+	}
+
+	entries, err := DefaultJournal.Entries()
+	if err != nil {
+		return config.JournalEntry{}, false, err
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].Remote == r.Name && entries[i].DeploymentID == id {
+			return entries[i], true, nil
+		}
+	}
+	return config.JournalEntry{}, false, nil
+}
+
+// recordedSource rebuilds the template and override recorded in the entry.
+func recordedSource(e config.JournalEntry) (templateSource, error) {
+	src := templateSource{Path: e.TemplatePath, OverridePath: e.OverridePath}
+	if e.TemplateHash == "" {
+		return src, errors.New("no template was recorded")
+	}
+
+	var err error
+	if src.Template, err = DefaultJournal.Template(e.TemplateHash); err != nil {
+		return src, err
+	}
+	if e.OverrideHash != "" {
+		if src.Override, err = DefaultJournal.Template(e.OverrideHash); err != nil {
+			return src, err
+		}
+	}
+	return src, nil
+}
+
+// recordedTemplate finds the content and path of the template that the
+// deployment with the given ID on the remote was most recently created from.
+func recordedTemplate(r config.Remote, id int) ([]byte, string, bool, error) {
+	e, found, err := latestEntry(r, id)
+	if err != nil || !found || e.TemplateHash == "" {
+		return nil, "", false, err
+	}
+
+	src, err := recordedSource(e)
+	return src.Template, src.Path, err == nil, err
+}
+
+// introducesRevision is true for entries that deploy a template, as opposed
+// to redeploying or deleting an existing deployment.
+func introducesRevision(e config.JournalEntry) bool {
+	switch e.Action {
+	case "create", "rollback", "upgrade":
+		return e.TemplateHash != ""
+	}
+	return false
+}
+
+// revisionKey identifies the revisions of a deployment name on a remote.
+type revisionKey struct {
+	Remote string
+	Name   string
+}
+
+// revisionNumbers numbers each entry with the revision of its deployment that
+// it belongs to. A deployment name gets a new revision each time it is
+// deployed from a different template or override than the one before.
+func revisionNumbers(entries []config.JournalEntry) []int {
+	numbers := make([]int, len(entries))
+	current := make(map[revisionKey]int)
+	last := make(map[revisionKey]config.JournalEntry)
+	for i, e := range entries {
+		k := revisionKey{e.Remote, e.Name}
+		if introducesRevision(e) {
+			l, ok := last[k]
+			if !ok || l.TemplateHash != e.TemplateHash || l.OverrideHash != e.OverrideHash {
+				current[k]++
+			}
+			last[k] = e
+		}
+		numbers[i] = current[k]
+	}
+	return numbers
+}
+
+// deploymentRevisions returns the entry that first deployed each revision of
+// the named deployment on the remote, oldest first.
+func deploymentRevisions(r config.Remote, name string) ([]config.JournalEntry, error) {
+	if DefaultJournal == nil {
+		return nil, errors.New("there is no local journal")
+	}
+
+	entries, err := DefaultJournal.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []config.JournalEntry
+	for i, n := range revisionNumbers(entries) {
+		e := entries[i]
+		if e.Remote == r.Name && e.Name == name && introducesRevision(e) && n > len(revisions) {
+			revisions = append(revisions, e)
+		}
+	}
+	return revisions, nil
+}
+
+func currentUser() string {
+	// os/user isn't available when cross-compiling, so rely on the
+	// environment.
+	for _, v := range []string{"USER", "USERNAME"} {
+		if u := os.Getenv(v); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// DeploymentHistory lists the journal's entries, optionally limited to those
+// for a single remote or deployment name.
+func DeploymentHistory(remote string, name string) (prettycli.Output, error) {
+	if DefaultJournal == nil {
+		return prettycli.PlainOutput{}, errors.New("there is no local journal")
+	}
+
+	entries, err := DefaultJournal.Entries()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	o := prettycli.ListOutput{Labels: []string{
+		"Time", "User", "Remote", "Action", "ID", "Name", "Revision", "Template", "Hash", "Override",
+	}}
+	revisions := revisionNumbers(entries)
+	for i, e := range entries {
+		if (remote != "" && e.Remote != remote) || (name != "" && e.Name != name) {
+			continue
+		}
+
+		o.AddRow(map[string]string{
+			"Time":     e.Time.Local().Format("2006-01-02 15:04:05"),
+			"User":     e.User,
+			"Remote":   e.Remote,
+			"Action":   e.Action,
+			"ID":       strconv.Itoa(e.DeploymentID),
+			"Name":     e.Name,
+			"Revision": revisionLabel(revisions[i]),
+			"Template": e.TemplatePath,
+			"Hash":     shortHash(e.TemplateHash),
+			"Override": e.OverridePath,
+		})
+	}
+
+	if len(o.Rows) == 0 {
+		return prettycli.PlainOutput{"No history"}, nil
+	}
+	return &o, nil
+}
+
+func revisionLabel(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -0,0 +1,179 @@
+package actions
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+	"github.com/stretchr/testify/assert"
+)
+
+type FakeJournal struct {
+	Recorded          []config.JournalEntry
+	Templates         map[string][]byte
+	ErrorForRecord    error
+	ErrorForEntries   error
+	ErrorForTemplates error
+}
+
+func (j *FakeJournal) Record(e config.JournalEntry, template []byte, override []byte) error {
+	if j.ErrorForRecord != nil {
+		return j.ErrorForRecord
+	}
+	if template != nil {
+		e.TemplateHash = j.save(template)
+	}
+	if override != nil {
+		e.OverrideHash = j.save(override)
+	}
+	j.Recorded = append(j.Recorded, e)
+	return nil
+}
+
+func (j *FakeJournal) save(template []byte) string {
+	if j.Templates == nil {
+		j.Templates = make(map[string][]byte)
+	}
+	hash := config.TemplateHash(template)
+	j.Templates[hash] = template
+	return hash
+}
+
+func (j *FakeJournal) Entries() ([]config.JournalEntry, error) {
+	return j.Recorded, j.ErrorForEntries
+}
+
+func (j *FakeJournal) Template(hash string) ([]byte, error) {
+	return j.Templates[hash], j.ErrorForTemplates
+}
+
+func setupJournal() *FakeJournal {
+	j := &FakeJournal{}
+	DefaultJournal = j
+	return j
+}
+
+func TestRecordCreate(t *testing.T) {
+	j := setupJournal()
+	os.Setenv("USER", "alice")
+	r := config.Remote{Name: "Test"}
+	dr := agent.DeploymentResponseLite{ID: 3, Name: "Wordpress"}
+	recordCreate(r, dr, templateSource{Path: "wp.pmx", Template: []byte("template"), OverridePath: "prod.pmx", Override: []byte("override")})
+
+	if assert.Len(t, j.Recorded, 1) {
+		e := j.Recorded[0]
+		assert.Equal(t, "create", e.Action)
+		assert.Equal(t, "alice", e.User)
+		assert.Equal(t, "Test", e.Remote)
+		assert.Equal(t, 3, e.DeploymentID)
+		assert.Equal(t, "Wordpress", e.Name)
+		assert.Equal(t, "wp.pmx", e.TemplatePath)
+		assert.Equal(t, config.TemplateHash([]byte("template")), e.TemplateHash)
+		assert.Equal(t, "prod.pmx", e.OverridePath)
+		assert.Equal(t, config.TemplateHash([]byte("override")), e.OverrideHash)
+		assert.False(t, e.Time.IsZero())
+	}
+}
+
+func TestErroredRecordCreate(t *testing.T) {
+	j := setupJournal()
+	j.ErrorForRecord = errors.New("test error")
+	var warnings bytes.Buffer
+	Warnings = &warnings
+	defer func() { Warnings = os.Stderr }()
+
+	assert.NotPanics(t, func() {
+		recordCreate(config.Remote{}, agent.DeploymentResponseLite{}, templateSource{})
+	})
+	assert.Equal(t, "Warning: the deployment could not be recorded in the local journal: test error\n", warnings.String())
+}
+
+func TestRecordRedeployAndDelete(t *testing.T) {
+	j := setupJournal()
+	r := config.Remote{Name: "Test"}
+	recordCreate(r, agent.DeploymentResponseLite{ID: 1, Name: "WP"}, templateSource{Path: "wp.pmx", Template: []byte("template")})
+	recordRedeploy(r, 1, agent.DeploymentResponseLite{ID: 2, Name: "WP"})
+	recordDelete(r, 2)
+
+	if assert.Len(t, j.Recorded, 3) {
+		redeploy := j.Recorded[1]
+		assert.Equal(t, "redeploy", redeploy.Action)
+		assert.Equal(t, 2, redeploy.DeploymentID)
+		assert.Equal(t, 1, redeploy.PreviousID)
+		assert.Equal(t, "wp.pmx", redeploy.TemplatePath)
+		assert.Equal(t, j.Recorded[0].TemplateHash, redeploy.TemplateHash)
+
+		del := j.Recorded[2]
+		assert.Equal(t, "delete", del.Action)
+		assert.Equal(t, 2, del.DeploymentID)
+		assert.Equal(t, 0, del.PreviousID)
+		assert.Equal(t, "WP", del.Name)
+	}
+}
+
+func TestRecordedTemplate(t *testing.T) {
+	setupJournal()
+	staging := config.Remote{Name: "Staging"}
+	recordCreate(staging, agent.DeploymentResponseLite{ID: 1}, templateSource{Path: "old.pmx", Template: []byte("old")})
+	recordCreate(staging, agent.DeploymentResponseLite{ID: 2}, templateSource{Path: "other.pmx", Template: []byte("other")})
+	recordCreate(staging, agent.DeploymentResponseLite{ID: 1}, templateSource{Path: "new.pmx", Template: []byte("new")})
+
+	b, path, found, err := recordedTemplate(staging, 1)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "new", string(b))
+	assert.Equal(t, "new.pmx", path)
+
+	_, _, found, err = recordedTemplate(config.Remote{Name: "Prod"}, 1)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestNoJournalRecordedTemplate(t *testing.T) {
+	DefaultJournal = nil
+	_, _, found, err := recordedTemplate(config.Remote{}, 1)
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestDeploymentHistory(t *testing.T) {
+	setupJournal()
+	recordCreate(config.Remote{Name: "Staging"}, agent.DeploymentResponseLite{ID: 1, Name: "WP"}, templateSource{Path: "wp.pmx", Template: []byte("template")})
+	recordCreate(config.Remote{Name: "Prod"}, agent.DeploymentResponseLite{ID: 4, Name: "WP"}, templateSource{Path: "wp.pmx", Template: []byte("template")})
+	recordCreate(config.Remote{Name: "Prod"}, agent.DeploymentResponseLite{ID: 5, Name: "Redis"}, templateSource{Path: "redis.pmx"})
+
+	o, err := DeploymentHistory("", "WP")
+	assert.NoError(t, err)
+	lo := o.(*prettycli.ListOutput)
+	if assert.Len(t, lo.Rows, 2) {
+		assert.Equal(t, "Staging", lo.Rows[0]["Remote"])
+		assert.Equal(t, "create", lo.Rows[0]["Action"])
+		assert.Equal(t, "1", lo.Rows[0]["ID"])
+		assert.Equal(t, "1", lo.Rows[0]["Revision"])
+		assert.Equal(t, "wp.pmx", lo.Rows[0]["Template"])
+		assert.Len(t, lo.Rows[0]["Hash"], 12)
+	}
+
+	o, err = DeploymentHistory("Prod", "")
+	assert.NoError(t, err)
+	assert.Len(t, o.(*prettycli.ListOutput).Rows, 2)
+
+	o, err = DeploymentHistory("Prod", "Missing")
+	assert.NoError(t, err)
+	assert.Equal(t, "No history", o.ToPrettyOutput())
+}
+
+func TestErroredDeploymentHistory(t *testing.T) {
+	j := setupJournal()
+	j.ErrorForEntries = errors.New("test error")
+	_, err := DeploymentHistory("", "")
+	assert.EqualError(t, err, "test error")
+
+	DefaultJournal = nil
+	_, err = DeploymentHistory("", "")
+	assert.EqualError(t, err, "there is no local journal")
+}
@@ -1,16 +1,25 @@
 package actions
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/agentclient"
 	"github.com/CenturyLinkLabs/panamaxcli/config"
 	"github.com/CenturyLinkLabs/prettycli"
+	"rsc.io/qr"
 )
 
 var format = regexp.MustCompile("^[a-zA-Z0-9]+$")
@@ -46,6 +55,37 @@ func AddRemoteByPath(config config.Config, name string, path string) (prettycli.
 	return AddRemote(config, name, token)
 }
 
+// AddRemoteWithClientCert adds a remote that presents a client certificate,
+// for agents behind proxies that require one. The certificate is checked
+// before the remote is added, and the remote is removed again if the
+// certificate can't be saved with it, so that adding it can be retried.
+func AddRemoteWithClientCert(c config.Config, name string, path string, certPath string, keyPath string) (prettycli.Output, error) {
+	if certPath == "" || keyPath == "" {
+		return prettycli.PlainOutput{}, errors.New("a client certificate needs both --client-cert and --client-key")
+	}
+	certPath, keyPath, err := checkClientCert(certPath, keyPath)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	o, err := AddRemoteByPath(c, name, path)
+	if err != nil {
+		return o, err
+	}
+	r, err := c.Get(name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	r.ClientCert, r.ClientKey = certPath, keyPath
+	if err := c.Update(r); err != nil {
+		if rErr := c.Remove(name); rErr != nil {
+			return prettycli.PlainOutput{}, fmt.Errorf("the client certificate could not be saved: %s, and the remote '%s' could not be removed either, remove it with 'pmxcli remote remove %s': %s", err, name, name, rErr)
+		}
+		return prettycli.PlainOutput{}, fmt.Errorf("the client certificate could not be saved, so the remote wasn't added: %s", err)
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("%s It will present the client certificate '%s'.", o.ToPrettyOutput(), certPath)}, nil
+}
+
 func RemoveRemote(config config.Config, name string) (prettycli.Output, error) {
 	if err := config.Remove(name); err != nil {
 		return prettycli.PlainOutput{}, err
@@ -54,16 +94,16 @@ func RemoveRemote(config config.Config, name string) (prettycli.Output, error) {
 	return prettycli.PlainOutput{out}, nil
 }
 
-func ListRemotes(config config.Config) prettycli.Output {
-	agents := config.Remotes()
+func ListRemotes(c config.Config, selector config.Labels) prettycli.Output {
+	agents := config.SelectRemotes(c.Remotes(), selector)
 	if len(agents) == 0 {
 		return prettycli.PlainOutput{"No remotes"}
 	}
 
-	output := prettycli.ListOutput{Labels: []string{"Active", "Name", "Endpoint"}}
-	for _, r := range config.Remotes() {
+	output := prettycli.ListOutput{Labels: []string{"Active", "Name", "Endpoint", "Labels"}}
+	for _, r := range agents {
 		activeMarker := ""
-		if config.Active() != nil && *config.Active() == r {
+		if c.Active() != nil && c.Active().Name == r.Name {
 			activeMarker = "*"
 		}
 
@@ -71,11 +111,214 @@ func ListRemotes(config config.Config) prettycli.Output {
 			"Active":   activeMarker,
 			"Name":     r.Name,
 			"Endpoint": r.Endpoint,
+			"Labels":   r.Labels.String(),
 		})
 	}
 	return &output
 }
 
+// LabelRemote adds the labels to the remote, replacing the values of any that
+// it already has.
+func LabelRemote(c config.Config, name string, labels config.Labels) (prettycli.Output, error) {
+	r, err := c.Get(name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	updated := config.Labels{}
+	for k, v := range r.Labels {
+		updated[k] = v
+	}
+	for k, v := range labels {
+		updated[k] = v
+	}
+	r.Labels = updated
+
+	if err := c.Update(r); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("'%s' is now labelled %s", name, r.Labels)}, nil
+}
+
+// UnlabelRemote removes the labels with the given keys from the remote.
+func UnlabelRemote(c config.Config, name string, keys []string) (prettycli.Output, error) {
+	r, err := c.Get(name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	updated := config.Labels{}
+	for k, v := range r.Labels {
+		updated[k] = v
+	}
+	for _, k := range keys {
+		if _, ok := updated[k]; !ok {
+			return prettycli.PlainOutput{}, fmt.Errorf("remote '%s' has no label '%s'", name, k)
+		}
+		delete(updated, k)
+	}
+	r.Labels = updated
+
+	if err := c.Update(r); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if len(r.Labels) == 0 {
+		return prettycli.PlainOutput{fmt.Sprintf("'%s' no longer has any labels", name)}, nil
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("'%s' is now labelled %s", name, r.Labels)}, nil
+}
+
+// SetRemoteTimeouts changes how long calls to the remote may take. Zero
+// timeouts leave the remote's current ones as they are.
+func SetRemoteTimeouts(c config.Config, name string, timeouts config.Timeouts) (prettycli.Output, error) {
+	if timeouts.Read < 0 || timeouts.Mutate < 0 {
+		return prettycli.PlainOutput{}, errors.New("timeouts can't be negative")
+	}
+	r, err := c.Get(name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	updated := config.Timeouts{}
+	if r.Timeouts != nil {
+		updated = *r.Timeouts
+	}
+	if timeouts.Read > 0 {
+		updated.Read = timeouts.Read
+	}
+	if timeouts.Mutate > 0 {
+		updated.Mutate = timeouts.Mutate
+	}
+	r.Timeouts = &updated
+
+	if err := c.Update(r); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("'%s' now allows %s", name, describeTimeouts(remoteTimeouts(r)))}, nil
+}
+
+// ResetRemoteTimeouts makes the remote use the default timeouts again.
+func ResetRemoteTimeouts(c config.Config, name string) (prettycli.Output, error) {
+	r, err := c.Get(name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	r.Timeouts = nil
+	if err := c.Update(r); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("'%s' now allows %s", name, describeTimeouts(remoteTimeouts(r)))}, nil
+}
+
+// SetRemoteProxy makes calls to the remote go through the proxy, or connect
+// directly with agentclient.Direct. An empty proxy goes back to using the
+// proxy environment variables.
+func SetRemoteProxy(c config.Config, name string, proxy string) (prettycli.Output, error) {
+	if proxy != "" && proxy != agentclient.Direct {
+		if _, err := agentclient.ParseProxy(proxy); err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+	}
+	r, err := c.Get(name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	r.Proxy = proxy
+	if err := c.Update(r); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	switch proxy {
+	case "":
+		return prettycli.PlainOutput{fmt.Sprintf("'%s' will use the proxy in HTTPS_PROXY or HTTP_PROXY, if any", name)}, nil
+	case agentclient.Direct:
+		return prettycli.PlainOutput{fmt.Sprintf("'%s' will be reached directly, without a proxy", name)}, nil
+	default:
+		return prettycli.PlainOutput{fmt.Sprintf("'%s' will be reached through the proxy '%s'", name, proxy)}, nil
+	}
+}
+
+// SetRemoteCABundle makes the remote trust the certificates in the PEM file,
+// besides the one in its token. An empty path removes the bundle.
+func SetRemoteCABundle(c config.Config, name string, path string) (prettycli.Output, error) {
+	if path != "" {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		if _, err := agentclient.CertPool("", []string{abs}); err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		path = abs
+	}
+	r, err := c.Get(name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	r.CABundle = path
+	if err := c.Update(r); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if path == "" {
+		return prettycli.PlainOutput{fmt.Sprintf("'%s' will only trust the certificate in its token", name)}, nil
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("'%s' will also trust the certificates in '%s'", name, path)}, nil
+}
+
+// SetRemoteClientCert makes the remote present the client certificate in the
+// PEM files, which is checked first. Empty paths stop it presenting one.
+func SetRemoteClientCert(c config.Config, name string, certPath string, keyPath string) (prettycli.Output, error) {
+	if certPath != "" || keyPath != "" {
+		var err error
+		if certPath, keyPath, err = checkClientCert(certPath, keyPath); err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+	}
+	r, err := c.Get(name)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	r.ClientCert, r.ClientKey = certPath, keyPath
+	if err := c.Update(r); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if certPath == "" {
+		return prettycli.PlainOutput{fmt.Sprintf("'%s' will not present a client certificate", name)}, nil
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("'%s' will present the client certificate '%s'", name, certPath)}, nil
+}
+
+// checkClientCert makes the paths of a client certificate and its key
+// absolute, since they're read each time the remote is used, and checks that
+// they can be loaded.
+func checkClientCert(certPath string, keyPath string) (string, string, error) {
+	if certPath != "" {
+		abs, err := filepath.Abs(certPath)
+		if err != nil {
+			return "", "", err
+		}
+		certPath = abs
+	}
+	if keyPath != "" {
+		abs, err := filepath.Abs(keyPath)
+		if err != nil {
+			return "", "", err
+		}
+		keyPath = abs
+	}
+	if _, err := agentclient.ClientCertificate(certPath, keyPath); err != nil {
+		return "", "", err
+	}
+	return certPath, keyPath, nil
+}
+
+func describeTimeouts(t agentclient.Timeouts) string {
+	return fmt.Sprintf("%s for reads, %s for changes", t.Read, t.Mutate)
+}
+
 func DescribeRemote(c config.Config, name string) (prettycli.Output, error) {
 	r, err := c.Get(name)
 	if err != nil {
@@ -93,20 +336,11 @@ func DescribeRemote(c config.Config, name string) (prettycli.Output, error) {
 		return prettycli.PlainOutput{}, err
 	}
 
-	adapterMetadataBytes, err := json.Marshal(metadata.Adapter)
+	adapterMetadata, err := decodeAdapterMetadata(metadata)
 	if err != nil {
 		return prettycli.PlainOutput{}, err
 	}
 
-	adapterMetadata := struct {
-		Version   string
-		Type      string
-		IsHealthy bool
-	}{}
-	if err := json.Unmarshal(adapterMetadataBytes, &adapterMetadata); err != nil {
-		return prettycli.PlainOutput{}, err
-	}
-
 	do := prettycli.DetailOutput{
 		Details: map[string]string{
 			"Name":               r.Name,
@@ -116,6 +350,7 @@ func DescribeRemote(c config.Config, name string) (prettycli.Output, error) {
 			"Adapter Version":    adapterMetadata.Version,
 			"Adapter Type":       adapterMetadata.Type,
 			"Adapter Is Healthy": strconv.FormatBool(adapterMetadata.IsHealthy),
+			"Timeouts":           describeTimeouts(remoteTimeouts(r)),
 		},
 		Order: []string{"Name", "Active", "Endpoint"},
 	}
@@ -132,6 +367,92 @@ func DescribeRemote(c config.Config, name string) (prettycli.Output, error) {
 	return &co, nil
 }
 
+// adapterMetadata is the subset of the adapter's free-form metadata that the
+// CLI knows how to display.
+type adapterMetadata struct {
+	Version   string
+	Type      string
+	IsHealthy bool
+}
+
+func decodeAdapterMetadata(metadata agent.Metadata) (adapterMetadata, error) {
+	am := adapterMetadata{}
+	b, err := json.Marshal(metadata.Adapter)
+	if err != nil {
+		return am, err
+	}
+
+	err = json.Unmarshal(b, &am)
+	return am, err
+}
+
+// RemoteStatus queries each of the remotes concurrently and summarizes
+// their health in a single table. Remotes that fail or take longer than
+// timeout to respond are reported as unreachable rather than causing an
+// error.
+func RemoteStatus(remotes []config.Remote, timeout time.Duration) prettycli.Output {
+	if len(remotes) == 0 {
+		return prettycli.PlainOutput{"No remotes"}
+	}
+
+	type status struct {
+		Metadata    agent.Metadata
+		Adapter     adapterMetadata
+		Deployments int
+		Latency     time.Duration
+	}
+
+	results := fanOut(remotes, 0, timeout, func(r config.Remote) (interface{}, error) {
+		client := DefaultAgentClientFactory.New(r)
+		start := time.Now()
+		metadata, err := client.GetMetadata()
+		if err != nil {
+			return nil, err
+		}
+		latency := time.Since(start)
+
+		am, err := decodeAdapterMetadata(metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		deps, err := client.ListDeployments()
+		if err != nil {
+			return nil, err
+		}
+
+		return status{metadata, am, len(deps), latency}, nil
+	})
+
+	o := prettycli.ListOutput{Labels: []string{
+		"Name", "Endpoint", "Reachable", "Agent Version", "Adapter Type",
+		"Adapter Version", "Adapter Healthy", "Deployments", "Latency", "Error",
+	}}
+	for _, res := range results {
+		row := map[string]string{
+			"Name":      res.Remote.Name,
+			"Endpoint":  res.Remote.Endpoint,
+			"Reachable": "false",
+		}
+
+		if res.Err != nil {
+			row["Error"] = res.Err.Error()
+		} else {
+			s := res.Value.(status)
+			row["Reachable"] = "true"
+			row["Agent Version"] = s.Metadata.Agent.Version
+			row["Adapter Type"] = s.Adapter.Type
+			row["Adapter Version"] = s.Adapter.Version
+			row["Adapter Healthy"] = strconv.FormatBool(s.Adapter.IsHealthy)
+			row["Deployments"] = strconv.Itoa(s.Deployments)
+			row["Latency"] = s.Latency.String()
+		}
+		o.AddRow(row)
+	}
+
+	return &o
+}
+
 func SetActiveRemote(config config.Config, name string) (prettycli.Output, error) {
 	if err := config.SetActive(name); err != nil {
 		return prettycli.PlainOutput{}, err
@@ -139,10 +460,109 @@ func SetActiveRemote(config config.Config, name string) (prettycli.Output, error
 	return prettycli.PlainOutput{fmt.Sprintf("'%s' is now your active remote!", name)}, nil
 }
 
-func GetRemoteToken(c config.Config, name string) (prettycli.Output, error) {
+// TokenOptions controls how GetRemoteToken gives out a remote's token, which
+// holds the agent's password and certificate.
+type TokenOptions struct {
+	// Reveal prints the token itself.
+	Reveal bool
+	// CopyPath is a file to write the token to, readable only by its owner.
+	CopyPath string
+	// QR prints the token as a QR code, to be scanned on another workstation.
+	QR bool
+}
+
+// GetRemoteToken describes the remote's token without revealing it, unless
+// the options ask for the token itself.
+func GetRemoteToken(c config.Config, name string, opts TokenOptions) (prettycli.Output, error) {
 	r, err := c.Get(name)
 	if err != nil {
 		return prettycli.PlainOutput{}, err
 	}
-	return prettycli.PlainOutput{r.Token}, nil
+
+	switch {
+	case opts.CopyPath != "":
+		if err := writePrivateFile(opts.CopyPath, []byte(r.Token+"\n")); err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		return prettycli.PlainOutput{fmt.Sprintf("Wrote the token for '%s' to '%s'", r.Name, opts.CopyPath)}, nil
+	case opts.QR:
+		code, err := qr.Encode(r.Token, qr.L)
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		return prettycli.PlainOutput{renderQR(code)}, nil
+	case opts.Reveal:
+		return prettycli.PlainOutput{r.Token}, nil
+	}
+
+	if r.Endpoint == "" {
+		r.DecodeToken()
+	}
+	return prettycli.DetailOutput{
+		Details: map[string]string{
+			"Name":     r.Name,
+			"Endpoint": r.Endpoint,
+			"Username": r.Username,
+			"Token":    tokenFingerprint(r.Token) + " (use --reveal to print it)",
+		},
+		Order: []string{"Name", "Endpoint", "Username", "Token"},
+	}, nil
+}
+
+// tokenFingerprint identifies a token, so that two can be compared, without
+// revealing anything in it.
+func tokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "SHA256:" + hex.EncodeToString(sum[:8])
+}
+
+// writePrivateFile writes the file so that only its owner can read it, even
+// when it already exists with other permissions.
+func writePrivateFile(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Chmod(0600); err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	return err
+}
+
+// qrQuietZone is the light border, in modules, that scanners need around a
+// QR code. The spec requires four.
+const qrQuietZone = 4
+
+// renderQR draws the code with block characters, two rows of modules to a
+// line. Light modules are drawn and dark ones left blank, so the code reads
+// correctly on the usual dark terminal background.
+func renderQR(code *qr.Code) string {
+	dark := func(x, y int) bool {
+		x, y = x-qrQuietZone, y-qrQuietZone
+		return x >= 0 && y >= 0 && x < code.Size && y < code.Size && code.Black(x, y)
+	}
+
+	size := code.Size + 2*qrQuietZone
+	var lines []string
+	for y := 0; y < size; y += 2 {
+		var b bytes.Buffer
+		for x := 0; x < size; x++ {
+			top := !dark(x, y)
+			bottom := y+1 < size && !dark(x, y+1)
+			switch {
+			case top && bottom:
+				b.WriteString("\u2588")
+			case top:
+				b.WriteString("\u2580")
+			case bottom:
+				b.WriteString("\u2584")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		lines = append(lines, b.String())
+	}
+	return strings.Join(lines, "\n")
 }
@@ -1,11 +1,20 @@
 package actions
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
 	"github.com/CenturyLinkLabs/panamaxcli/config"
@@ -25,6 +34,12 @@ type FakeConfig struct {
 	ActivatedRemoteName string
 	ErrorForSetActive   error
 	ErrorForRemove      error
+	UpdatedRemote       config.Remote
+	ErrorForUpdate      error
+	Repos               []string
+	ErrorForRepo        error
+	Secrets             *config.SecretStore
+	ErrorForSecrets     error
 }
 
 func (c *FakeConfig) Save(name string, token string) error {
@@ -34,6 +49,57 @@ func (c *FakeConfig) Save(name string, token string) error {
 	return c.ErrorForSave
 }
 
+func (c *FakeConfig) Update(r config.Remote) error {
+	c.UpdatedRemote = r
+	if c.ErrorForUpdate != nil {
+		return c.ErrorForUpdate
+	}
+	for i, existing := range c.Agents {
+		if existing.Name == r.Name {
+			c.Agents[i] = r
+		}
+	}
+	return nil
+}
+
+func (c *FakeConfig) TemplateRepos() []string {
+	return c.Repos
+}
+
+func (c *FakeConfig) AddTemplateRepo(path string) error {
+	if c.ErrorForRepo != nil {
+		return c.ErrorForRepo
+	}
+	c.Repos = append(c.Repos, path)
+	return nil
+}
+
+func (c *FakeConfig) RemoveTemplateRepo(path string) error {
+	if c.ErrorForRepo != nil {
+		return c.ErrorForRepo
+	}
+	var repos []string
+	for _, r := range c.Repos {
+		if r != path {
+			repos = append(repos, r)
+		}
+	}
+	c.Repos = repos
+	return nil
+}
+
+func (c *FakeConfig) SecretStore() *config.SecretStore {
+	return c.Secrets
+}
+
+func (c *FakeConfig) SetSecretStore(s config.SecretStore) error {
+	if c.ErrorForSecrets != nil {
+		return c.ErrorForSecrets
+	}
+	c.Secrets = &s
+	return nil
+}
+
 func (c *FakeConfig) Remove(name string) error {
 	c.RemovedName = name
 	return c.ErrorForRemove
@@ -82,6 +148,66 @@ func TestAddRemote(t *testing.T) {
 	assert.Equal(t, "testname", fc.ActivatedRemoteName)
 }
 
+func writeClientCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "pmx-client-cert")
+	assert.NoError(t, err)
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certPath, keyPath
+}
+
+func TestAddRemoteWithClientCert(t *testing.T) {
+	certPath, keyPath := writeClientCertificate(t)
+	defer os.RemoveAll(filepath.Dir(certPath))
+	tokenPath := filepath.Join(filepath.Dir(certPath), "token")
+	ioutil.WriteFile(tokenPath, TestTokenData, 0600)
+	fc := FakeConfig{}
+
+	output, err := AddRemoteWithClientCert(&fc, "testname", tokenPath, certPath, keyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "token data", fc.SavedToken)
+	assert.Equal(t, certPath, fc.UpdatedRemote.ClientCert)
+	assert.Equal(t, keyPath, fc.UpdatedRemote.ClientKey)
+	assert.Equal(t, fmt.Sprintf("Successfully added! 'testname' is your active remote. It will present the client certificate '%s'.", certPath), output.ToPrettyOutput())
+}
+
+func TestErroredAddRemoteWithClientCert(t *testing.T) {
+	certPath, keyPath := writeClientCertificate(t)
+	defer os.RemoveAll(filepath.Dir(certPath))
+	fc := FakeConfig{}
+
+	_, err := AddRemoteWithClientCert(&fc, "testname", "/nonexistant/token", certPath, "")
+	assert.EqualError(t, err, "a client certificate needs both --client-cert and --client-key")
+	_, err = AddRemoteWithClientCert(&fc, "testname", "/nonexistant/token", keyPath, certPath)
+	assert.Contains(t, err.Error(), "the client certificate could not be loaded")
+	assert.Empty(t, fc.SavedName)
+}
+
+func TestErroredUpdateAddRemoteWithClientCert(t *testing.T) {
+	certPath, keyPath := writeClientCertificate(t)
+	defer os.RemoveAll(filepath.Dir(certPath))
+	tokenPath := filepath.Join(filepath.Dir(certPath), "token")
+	ioutil.WriteFile(tokenPath, TestTokenData, 0600)
+	fc := FakeConfig{ErrorForUpdate: errors.New("test error")}
+
+	_, err := AddRemoteWithClientCert(&fc, "testname", tokenPath, certPath, keyPath)
+	assert.EqualError(t, err, "the client certificate could not be saved, so the remote wasn't added: test error")
+	assert.Equal(t, "testname", fc.RemovedName)
+
+	fc.ErrorForRemove = errors.New("remove error")
+	_, err = AddRemoteWithClientCert(&fc, "other", tokenPath, certPath, keyPath)
+	assert.Contains(t, err.Error(), "remove it with 'pmxcli remote remove other': remove error")
+}
+
 func TestInactiveSecondAddRemote(t *testing.T) {
 	fc := FakeConfig{Agents: []config.Remote{{Name: "First"}}}
 	output, err := AddRemote(&fc, "Second", TestTokenData)
@@ -176,7 +302,7 @@ func TestListRemotes(t *testing.T) {
 		},
 		ActiveRemote: &active,
 	}
-	output := ListRemotes(&fc)
+	output := ListRemotes(&fc, nil)
 
 	lo, ok := output.(*prettycli.ListOutput)
 	if assert.True(t, ok) && assert.Len(t, lo.Rows, 2) {
@@ -189,16 +315,35 @@ func TestListRemotes(t *testing.T) {
 	}
 }
 
+func TestLabelsListRemotes(t *testing.T) {
+	fc := FakeConfig{
+		Agents: []config.Remote{
+			{Name: "Prod", Labels: config.Labels{"env": "prod", "region": "us-east"}},
+			{Name: "Staging", Labels: config.Labels{"env": "staging"}},
+		},
+	}
+	output := ListRemotes(&fc, config.Labels{"env": "prod"})
+
+	lo, ok := output.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 1) {
+		assert.Equal(t, "Prod", lo.Rows[0]["Name"])
+		assert.Equal(t, "env=prod,region=us-east", lo.Rows[0]["Labels"])
+	}
+
+	output = ListRemotes(&fc, config.Labels{"env": "dev"})
+	assert.Equal(t, "No remotes", output.ToPrettyOutput())
+}
+
 func TestNoActiveListRemotes(t *testing.T) {
 	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
 	assert.NotPanics(t, func() {
-		ListRemotes(&fc)
+		ListRemotes(&fc, nil)
 	})
 }
 
 func TestListRemotesNoRemotes(t *testing.T) {
 	fc := FakeConfig{}
-	output := ListRemotes(&fc)
+	output := ListRemotes(&fc, nil)
 	assert.Equal(t, "No remotes", output.ToPrettyOutput())
 }
 
@@ -294,19 +439,285 @@ func TestErroredSetActiveRemote(t *testing.T) {
 }
 
 func TestGetRemoteToken(t *testing.T) {
+	fc := FakeConfig{
+		Agents: []config.Remote{{Name: "Test", Token: "Token\nText", Endpoint: "https://example.com:3001", Username: "admin"}},
+	}
+	output, err := GetRemoteToken(&fc, "Test", TokenOptions{})
+
+	assert.NoError(t, err)
+	s := output.ToPrettyOutput()
+	assert.Contains(t, s, "Endpoint\thttps://example.com:3001")
+	assert.Contains(t, s, "Username\tadmin")
+	assert.Contains(t, s, "SHA256:c2bd09196d33d282 (use --reveal to print it)")
+	assert.NotContains(t, s, "Token\nText")
+}
+
+func TestRevealedGetRemoteToken(t *testing.T) {
 	fc := FakeConfig{
 		Agents: []config.Remote{{Name: "Test", Token: "Token\nText"}},
 	}
-	output, err := GetRemoteToken(&fc, "Test")
+	output, err := GetRemoteToken(&fc, "Test", TokenOptions{Reveal: true})
 
 	assert.NoError(t, err)
 	assert.Equal(t, "Token\nText", output.ToPrettyOutput())
 }
 
+func TestCopiedGetRemoteToken(t *testing.T) {
+	fc := FakeConfig{
+		Agents: []config.Remote{{Name: "Test", Token: "TokenText"}},
+	}
+	f, err := ioutil.TempFile("", "token")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.Chmod(0644)
+	f.Close()
+
+	output, err := GetRemoteToken(&fc, "Test", TokenOptions{CopyPath: f.Name()})
+	assert.NoError(t, err)
+	assert.Equal(t, "Wrote the token for 'Test' to '"+f.Name()+"'", output.ToPrettyOutput())
+	b, _ := ioutil.ReadFile(f.Name())
+	assert.Equal(t, "TokenText\n", string(b))
+	info, _ := os.Stat(f.Name())
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestQRGetRemoteToken(t *testing.T) {
+	fc := FakeConfig{
+		Agents: []config.Remote{{Name: "Test", Token: "TokenText"}},
+	}
+	output, err := GetRemoteToken(&fc, "Test", TokenOptions{QR: true})
+	assert.NoError(t, err)
+
+	// Version 1 codes are 21 modules across, plus the quiet zone on each side,
+	// drawn two rows to a line.
+	lines := strings.Split(output.ToPrettyOutput(), "\n")
+	assert.Len(t, lines, 15)
+	assert.Equal(t, strings.Repeat("\u2588", 29), lines[0])
+	assert.Equal(t, strings.Repeat("\u2588", 29), lines[1])
+	// The top left finder pattern starts with a row of seven dark modules,
+	// then a row with five light modules between dark ones.
+	assert.Equal(t, "\u2588\u2588\u2588\u2588 "+strings.Repeat("\u2584", 5)+" ", string([]rune(lines[2])[:11]))
+}
+
 func TestErroredGetRemoteToken(t *testing.T) {
 	fc := FakeConfig{}
-	output, err := GetRemoteToken(&fc, "nonexistant")
+	output, err := GetRemoteToken(&fc, "nonexistant", TokenOptions{})
 
 	assert.EqualError(t, err, "the remote 'nonexistant' does not exist")
 	assert.Empty(t, output.ToPrettyOutput())
 }
+
+func TestRemoteStatus(t *testing.T) {
+	setupFactory()
+	fakeFactory.Clients = map[string]*FakeClient{
+		"Up": {
+			Metadata: agent.Metadata{
+				Agent: agent.AgentMetadata{Version: "0.1"},
+				Adapter: map[string]interface{}{
+					"version": "0.2", "type": "Kubernetes", "isHealthy": true,
+				},
+			},
+			Deployments: []agent.DeploymentResponseLite{{ID: 1}, {ID: 2}},
+		},
+		"Down": {ErrorForMetadata: errors.New("connection refused")},
+	}
+	fc := FakeConfig{Agents: []config.Remote{
+		{Name: "Up", Endpoint: "https://up.example.com"},
+		{Name: "Down", Endpoint: "https://down.example.com"},
+	}}
+
+	o := RemoteStatus(fc.Remotes(), time.Second)
+	lo, ok := o.(*prettycli.ListOutput)
+	if assert.True(t, ok) && assert.Len(t, lo.Rows, 2) {
+		up := lo.Rows[0]
+		assert.Equal(t, "Up", up["Name"])
+		assert.Equal(t, "https://up.example.com", up["Endpoint"])
+		assert.Equal(t, "true", up["Reachable"])
+		assert.Equal(t, "0.1", up["Agent Version"])
+		assert.Equal(t, "Kubernetes", up["Adapter Type"])
+		assert.Equal(t, "0.2", up["Adapter Version"])
+		assert.Equal(t, "true", up["Adapter Healthy"])
+		assert.Equal(t, "2", up["Deployments"])
+		assert.NotEmpty(t, up["Latency"])
+		assert.Empty(t, up["Error"])
+
+		down := lo.Rows[1]
+		assert.Equal(t, "Down", down["Name"])
+		assert.Equal(t, "false", down["Reachable"])
+		assert.Equal(t, "connection refused", down["Error"])
+		assert.Empty(t, down["Deployments"])
+	}
+}
+
+func TestRemoteStatusNoRemotes(t *testing.T) {
+	fc := FakeConfig{}
+	assert.Equal(t, "No remotes", RemoteStatus(fc.Remotes(), time.Second).ToPrettyOutput())
+}
+
+func TestLabelRemote(t *testing.T) {
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test", Labels: config.Labels{"env": "staging", "team": "web"}}}}
+	o, err := LabelRemote(&fc, "Test", config.Labels{"env": "prod", "region": "us-east"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Test", fc.UpdatedRemote.Name)
+	assert.Equal(t, config.Labels{"env": "prod", "region": "us-east", "team": "web"}, fc.UpdatedRemote.Labels)
+	assert.Equal(t, "'Test' is now labelled env=prod,region=us-east,team=web", o.ToPrettyOutput())
+}
+
+func TestErroredNonexistantLabelRemote(t *testing.T) {
+	fc := FakeConfig{}
+	o, err := LabelRemote(&fc, "Bad", config.Labels{"env": "prod"})
+	assert.EqualError(t, err, "the remote 'Bad' does not exist")
+	assert.Empty(t, o.ToPrettyOutput())
+}
+
+func TestErroredUpdateLabelRemote(t *testing.T) {
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}, ErrorForUpdate: errors.New("test error")}
+	o, err := LabelRemote(&fc, "Test", config.Labels{"env": "prod"})
+	assert.EqualError(t, err, "test error")
+	assert.Empty(t, o.ToPrettyOutput())
+}
+
+func TestUnlabelRemote(t *testing.T) {
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test", Labels: config.Labels{"env": "prod", "team": "web"}}}}
+	o, err := UnlabelRemote(&fc, "Test", []string{"team"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, config.Labels{"env": "prod"}, fc.UpdatedRemote.Labels)
+	assert.Equal(t, "'Test' is now labelled env=prod", o.ToPrettyOutput())
+
+	o, err = UnlabelRemote(&fc, "Test", []string{"env"})
+	assert.NoError(t, err)
+	assert.Equal(t, "'Test' no longer has any labels", o.ToPrettyOutput())
+}
+
+func TestSetRemoteTimeouts(t *testing.T) {
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
+	o, err := SetRemoteTimeouts(&fc, "Test", config.Timeouts{Mutate: config.Duration(10 * time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, &config.Timeouts{Mutate: config.Duration(10 * time.Minute)}, fc.UpdatedRemote.Timeouts)
+	assert.Equal(t, "'Test' now allows 10s for reads, 10m0s for changes", o.ToPrettyOutput())
+
+	o, err = SetRemoteTimeouts(&fc, "Test", config.Timeouts{Read: config.Duration(30 * time.Second)})
+	assert.NoError(t, err)
+	assert.Equal(t, "'Test' now allows 30s for reads, 10m0s for changes", o.ToPrettyOutput())
+
+	o, err = ResetRemoteTimeouts(&fc, "Test")
+	assert.NoError(t, err)
+	assert.Nil(t, fc.UpdatedRemote.Timeouts)
+	assert.Equal(t, "'Test' now allows 10s for reads, 2m0s for changes", o.ToPrettyOutput())
+}
+
+func TestErroredSetRemoteTimeouts(t *testing.T) {
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
+	_, err := SetRemoteTimeouts(&fc, "Test", config.Timeouts{Read: config.Duration(-time.Second)})
+	assert.EqualError(t, err, "timeouts can't be negative")
+
+	_, err = SetRemoteTimeouts(&fc, "Missing", config.Timeouts{Read: config.Duration(time.Second)})
+	assert.EqualError(t, err, "the remote 'Missing' does not exist")
+	assert.Empty(t, fc.UpdatedRemote.Name)
+}
+
+func TestSetRemoteProxy(t *testing.T) {
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
+	o, err := SetRemoteProxy(&fc, "Test", "http://proxy.example.com:3128")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", fc.UpdatedRemote.Proxy)
+	assert.Equal(t, "'Test' will be reached through the proxy 'http://proxy.example.com:3128'", o.ToPrettyOutput())
+
+	o, err = SetRemoteProxy(&fc, "Test", "direct")
+	assert.NoError(t, err)
+	assert.Equal(t, "'Test' will be reached directly, without a proxy", o.ToPrettyOutput())
+
+	o, err = SetRemoteProxy(&fc, "Test", "")
+	assert.NoError(t, err)
+	assert.Empty(t, fc.UpdatedRemote.Proxy)
+	assert.Equal(t, "'Test' will use the proxy in HTTPS_PROXY or HTTP_PROXY, if any", o.ToPrettyOutput())
+}
+
+func TestErroredSetRemoteProxy(t *testing.T) {
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
+	_, err := SetRemoteProxy(&fc, "Test", "proxy.example.com:3128")
+	assert.EqualError(t, err, "'proxy.example.com:3128' is not a proxy URL, use e.g. 'http://proxy.example.com:3128'")
+	assert.Empty(t, fc.UpdatedRemote.Name)
+}
+
+func TestSetRemoteCABundle(t *testing.T) {
+	f, err := ioutil.TempFile("", "pmx-ca")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString(testCertificate)
+	f.Close()
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
+
+	o, err := SetRemoteCABundle(&fc, "Test", f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, f.Name(), fc.UpdatedRemote.CABundle)
+	assert.Equal(t, fmt.Sprintf("'Test' will also trust the certificates in '%s'", f.Name()), o.ToPrettyOutput())
+
+	CommandCAFile = "/etc/ssl/internal.pem"
+	defer func() { CommandCAFile = "" }()
+	assert.Equal(t, []string{f.Name(), "/etc/ssl/internal.pem"}, remoteCAFiles(fc.UpdatedRemote))
+
+	o, err = SetRemoteCABundle(&fc, "Test", "")
+	assert.NoError(t, err)
+	assert.Empty(t, fc.UpdatedRemote.CABundle)
+	assert.Equal(t, "'Test' will only trust the certificate in its token", o.ToPrettyOutput())
+}
+
+func TestErroredSetRemoteCABundle(t *testing.T) {
+	f, err := ioutil.TempFile("", "pmx-ca")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("not a certificate")
+	f.Close()
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
+
+	_, err = SetRemoteCABundle(&fc, "Test", f.Name())
+	assert.EqualError(t, err, fmt.Sprintf("the CA bundle '%s' has no PEM certificates", f.Name()))
+	_, err = SetRemoteCABundle(&fc, "Test", "/nonexistant.pem")
+	assert.EqualError(t, err, "the CA bundle could not be read: open /nonexistant.pem: no such file or directory")
+	assert.Empty(t, fc.UpdatedRemote.Name)
+}
+
+func TestSetRemoteClientCert(t *testing.T) {
+	certPath, keyPath := writeClientCertificate(t)
+	defer os.RemoveAll(filepath.Dir(certPath))
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test", Token: "token"}}}
+
+	o, err := SetRemoteClientCert(&fc, "Test", certPath, keyPath)
+	assert.NoError(t, err)
+	assert.Equal(t, certPath, fc.UpdatedRemote.ClientCert)
+	assert.Equal(t, keyPath, fc.UpdatedRemote.ClientKey)
+	assert.Equal(t, "token", fc.UpdatedRemote.Token)
+	assert.Equal(t, fmt.Sprintf("'Test' will present the client certificate '%s'", certPath), o.ToPrettyOutput())
+
+	o, err = SetRemoteClientCert(&fc, "Test", "", "")
+	assert.NoError(t, err)
+	assert.Empty(t, fc.UpdatedRemote.ClientCert)
+	assert.Empty(t, fc.UpdatedRemote.ClientKey)
+	assert.Equal(t, "'Test' will not present a client certificate", o.ToPrettyOutput())
+}
+
+func TestErroredSetRemoteClientCert(t *testing.T) {
+	certPath, keyPath := writeClientCertificate(t)
+	defer os.RemoveAll(filepath.Dir(certPath))
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
+
+	_, err := SetRemoteClientCert(&fc, "Test", certPath, "")
+	assert.EqualError(t, err, "a client certificate needs both a certificate and a key file")
+	_, err = SetRemoteClientCert(&fc, "Test", keyPath, certPath)
+	assert.Contains(t, err.Error(), "the client certificate could not be loaded")
+	assert.Empty(t, fc.UpdatedRemote.Name)
+
+	_, err = SetRemoteClientCert(&fc, "Missing", certPath, keyPath)
+	assert.EqualError(t, err, "the remote 'Missing' does not exist")
+}
+
+func TestErroredMissingLabelUnlabelRemote(t *testing.T) {
+	fc := FakeConfig{Agents: []config.Remote{{Name: "Test"}}}
+	o, err := UnlabelRemote(&fc, "Test", []string{"env"})
+	assert.EqualError(t, err, "remote 'Test' has no label 'env'")
+	assert.Empty(t, o.ToPrettyOutput())
+	assert.Empty(t, fc.UpdatedRemote.Name)
+}
@@ -0,0 +1,372 @@
+package actions
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamaxcli/template"
+	"github.com/CenturyLinkLabs/prettycli"
+)
+
+// NewTemplateOptions describes the template that NewTemplate scaffolds.
+// Except for Images and InspectPaths, each value is prefixed with the name of
+// the image it belongs to, as in "wp=8080:80", although the prefix can be left
+// off when the template has a single image.
+type NewTemplateOptions struct {
+	Description string
+	Keywords    string
+	// Images are "name=source", or just the source, in which case the image
+	// is named after it.
+	Images []string
+	// InspectPaths are files holding the output of `docker inspect`, whose
+	// images are added along with their exposed ports, environment and
+	// volumes.
+	InspectPaths []string
+	Ports        []string
+	Environment  []string
+	Links        []string
+	Volumes      []string
+	// Output is where the template is written, by default the template's name
+	// with a .pmx extension.
+	Output string
+	Force  bool
+	// When Interactive is set, the template is described by answering
+	// questions read from In and written to Out instead, with Description
+	// and Keywords as the default answers.
+	Interactive bool
+	In          io.Reader
+	Out         io.Writer
+}
+
+// imageEnvironmentToSkip is set by Docker or the base image of almost every
+// image and isn't worth putting in a template.
+var imageEnvironmentToSkip = map[string]bool{
+	"PATH":     true,
+	"HOME":     true,
+	"HOSTNAME": true,
+	"TERM":     true,
+}
+
+var unsafeFilenameCharacters = regexp.MustCompile(`[^a-z0-9]+`)
+
+// NewTemplate writes a skeleton template with the name, ready to be filled in.
+func NewTemplate(name string, opts NewTemplateOptions) (prettycli.Output, error) {
+	if opts.Interactive {
+		if err := askTemplateOptions(&opts); err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+	}
+
+	t, err := scaffoldTemplate(name, opts)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	problems := buildGraph(t.AgentTemplate()).problems()
+
+	path := opts.Output
+	if path == "" {
+		path = strings.Trim(unsafeFilenameCharacters.ReplaceAllString(strings.ToLower(name), "-"), "-") + ".pmx"
+	}
+	if _, err := os.Stat(path); err == nil && !opts.Force {
+		return prettycli.PlainOutput{}, fmt.Errorf("'%s' already exists, use --force to overwrite it", path)
+	}
+
+	b, err := t.Marshal()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if err := ioutil.WriteFile(path, b, 0644); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	o := prettycli.PlainOutput{fmt.Sprintf("Wrote template '%s' with %d image(s) to '%s'", name, len(t.Images), path)}
+	if len(problems) == 0 {
+		return o, nil
+	}
+	// The template is still written, since links are often added before the
+	// images they point to, but the problems are worth fixing before it's
+	// deployed.
+	co := prettycli.CombinedOutput{}
+	co.AddOutput("", o)
+	co.AddOutput("Problems", prettycli.PlainOutput{strings.Join(problems, "\n")})
+	return &co, nil
+}
+
+func scaffoldTemplate(name string, opts NewTemplateOptions) (template.Template, error) {
+	t := template.Template{
+		Name:          name,
+		Description:   opts.Description,
+		Keywords:      opts.Keywords,
+		Documentation: fmt.Sprintf("%s\n%s\n\nDescribe what this template deploys and how to use it.\n", name, strings.Repeat("=", len(name))),
+	}
+
+	for _, path := range opts.InspectPaths {
+		images, err := inspectedImages(path)
+		if err != nil {
+			return template.Template{}, err
+		}
+		t.Images = append(t.Images, images...)
+	}
+	for _, s := range opts.Images {
+		i := template.Image{Source: s}
+		if parts := strings.SplitN(s, "=", 2); len(parts) == 2 {
+			i = template.Image{Name: parts[0], Source: parts[1]}
+		} else {
+			i.Name = imageNameFromSource(s)
+		}
+		t.Images = append(t.Images, i)
+	}
+	if len(t.Images) == 0 {
+		return template.Template{}, fmt.Errorf("the template needs at least one image")
+	}
+	for _, i := range t.Images {
+		if i.Source == "" {
+			return template.Template{}, fmt.Errorf("image '%s' has no source", i.Name)
+		}
+	}
+
+	err := eachImageValue(&t, opts.Ports, func(i *template.Image, v string) error {
+		p, err := parsePort(v)
+		i.Ports = append(i.Ports, p)
+		return err
+	})
+	if err != nil {
+		return template.Template{}, err
+	}
+	err = eachImageValue(&t, opts.Environment, func(i *template.Image, v string) error {
+		parts := strings.SplitN(v, "=", 2)
+		e := template.Environment{Variable: parts[0]}
+		if len(parts) == 2 {
+			e.Value = parts[1]
+		}
+		i.Environment = append(i.Environment, e)
+		return nil
+	})
+	if err != nil {
+		return template.Template{}, err
+	}
+	err = eachImageValue(&t, opts.Links, func(i *template.Image, v string) error {
+		parts := strings.SplitN(v, ":", 2)
+		l := template.Link{Service: parts[0], Alias: parts[0]}
+		if len(parts) == 2 {
+			l.Alias = parts[1]
+		}
+		i.Links = append(i.Links, l)
+		return nil
+	})
+	if err != nil {
+		return template.Template{}, err
+	}
+	err = eachImageValue(&t, opts.Volumes, func(i *template.Image, v string) error {
+		parts := strings.SplitN(v, ":", 2)
+		vol := template.Volume{ContainerPath: parts[0]}
+		if len(parts) == 2 {
+			vol = template.Volume{HostPath: parts[0], ContainerPath: parts[1]}
+		}
+		i.Volumes = append(i.Volumes, vol)
+		return nil
+	})
+	if err != nil {
+		return template.Template{}, err
+	}
+
+	return t, nil
+}
+
+// eachImageValue calls apply with each value and the image it's prefixed with.
+func eachImageValue(t *template.Template, values []string, apply func(*template.Image, string) error) error {
+	for _, v := range values {
+		i, value, err := imageForValue(t, v)
+		if err != nil {
+			return err
+		}
+		if err := apply(i, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func imageForValue(t *template.Template, v string) (*template.Image, string, error) {
+	if parts := strings.SplitN(v, "=", 2); len(parts) == 2 {
+		for n := range t.Images {
+			if t.Images[n].Name == parts[0] {
+				return &t.Images[n], parts[1], nil
+			}
+		}
+	}
+	if len(t.Images) == 1 {
+		return &t.Images[0], v, nil
+	}
+	return nil, "", fmt.Errorf("'%s' must start with the name of one of the template's images, as in 'IMAGE=VALUE'", v)
+}
+
+// parsePort reads a port as "host:container" or "container", with an
+// optional "/tcp" or "/udp" protocol.
+func parsePort(s string) (template.Port, error) {
+	var p template.Port
+	if parts := strings.SplitN(s, "/", 2); len(parts) == 2 {
+		s = parts[0]
+		p.Protocol = strings.ToUpper(parts[1])
+	}
+
+	parts := strings.SplitN(s, ":", 2)
+	container, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return p, fmt.Errorf("'%s' is not a port, use HOST:CONTAINER", s)
+	}
+	host := container
+	if len(parts) == 2 {
+		if host, err = strconv.Atoi(parts[0]); err != nil {
+			return p, fmt.Errorf("'%s' is not a port, use HOST:CONTAINER", s)
+		}
+	}
+	p.HostPort = template.IntOrString(host)
+	p.ContainerPort = template.IntOrString(container)
+	return p, nil
+}
+
+// imageNameFromSource names an image after the last part of its repository,
+// so "centurylink/wordpress:3.9.1" becomes "wordpress".
+func imageNameFromSource(source string) string {
+	name := source
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.Index(name, ":"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// dockerInspection is the part of the output of `docker inspect` for an image
+// that's useful in a template.
+type dockerInspection struct {
+	ID       string `json:"Id"`
+	RepoTags []string
+	Config   struct {
+		ExposedPorts map[string]struct{}
+		Env          []string
+		Volumes      map[string]struct{}
+	}
+}
+
+func inspectedImages(path string) ([]template.Image, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var inspections []dockerInspection
+	if err := json.Unmarshal(b, &inspections); err != nil {
+		return nil, fmt.Errorf("'%s' is not the output of docker inspect: %s", path, err)
+	}
+
+	var images []template.Image
+	for _, in := range inspections {
+		source := in.ID
+		if len(in.RepoTags) > 0 {
+			source = in.RepoTags[0]
+		}
+		if source == "" {
+			return nil, fmt.Errorf("an image in '%s' has no tag or ID", path)
+		}
+		i := template.Image{Name: imageNameFromSource(source), Source: source}
+
+		var ports []string
+		for p := range in.Config.ExposedPorts {
+			ports = append(ports, p)
+		}
+		sort.Strings(ports)
+		for _, s := range ports {
+			p, err := parsePort(s)
+			if err != nil {
+				return nil, err
+			}
+			i.Ports = append(i.Ports, p)
+		}
+
+		for _, e := range in.Config.Env {
+			parts := strings.SplitN(e, "=", 2)
+			if imageEnvironmentToSkip[parts[0]] {
+				continue
+			}
+			env := template.Environment{Variable: parts[0]}
+			if len(parts) == 2 {
+				env.Value = parts[1]
+			}
+			i.Environment = append(i.Environment, env)
+		}
+
+		var volumes []string
+		for v := range in.Config.Volumes {
+			volumes = append(volumes, v)
+		}
+		sort.Strings(volumes)
+		for _, v := range volumes {
+			i.Volumes = append(i.Volumes, template.Volume{ContainerPath: v})
+		}
+
+		images = append(images, i)
+	}
+	return images, nil
+}
+
+// askTemplateOptions fills in the options by asking about the template and
+// each of its images in turn, until an empty image source is given. The
+// description and keywords already in the options are the defaults for their
+// questions, and the images are added to any already in them.
+func askTemplateOptions(opts *NewTemplateOptions) error {
+	s := bufio.NewScanner(opts.In)
+	ask := func(question string) string {
+		fmt.Fprintf(opts.Out, "%s: ", question)
+		if !s.Scan() {
+			return ""
+		}
+		return strings.TrimSpace(s.Text())
+	}
+	withDefault := func(question string, def string) string {
+		if def != "" {
+			question = fmt.Sprintf("%s [%s]", question, def)
+		}
+		if v := ask(question); v != "" {
+			return v
+		}
+		return def
+	}
+	// Values are asked for one at a time, rather than split on commas, since
+	// environment values can contain them.
+	list := func(image string, question string) []string {
+		var values []string
+		for {
+			v := ask(question + " (leave empty to finish)")
+			if v == "" {
+				return values
+			}
+			values = append(values, image+"="+v)
+		}
+	}
+
+	opts.Description = withDefault("Description", opts.Description)
+	opts.Keywords = withDefault("Keywords, separated by commas", opts.Keywords)
+	for {
+		source := ask("Image source, e.g. centurylink/wordpress:3.9.1 (leave empty to finish)")
+		if source == "" {
+			break
+		}
+		name := withDefault("Image name", imageNameFromSource(source))
+		opts.Images = append(opts.Images, name+"="+source)
+		opts.Ports = append(opts.Ports, list(name, "Port as HOST:CONTAINER")...)
+		opts.Environment = append(opts.Environment, list(name, "Environment variable as VARIABLE=VALUE")...)
+		opts.Links = append(opts.Links, list(name, "Link as IMAGE:ALIAS")...)
+		opts.Volumes = append(opts.Volumes, list(name, "Volume as HOST:CONTAINER")...)
+	}
+	return s.Err()
+}
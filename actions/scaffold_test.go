@@ -0,0 +1,125 @@
+package actions
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CenturyLinkLabs/panamaxcli/template"
+	"github.com/stretchr/testify/assert"
+)
+
+var dockerInspectOutput = `[{
+	"Id": "sha256:abc",
+	"RepoTags": ["centurylink/mysql:5.5"],
+	"Config": {
+		"ExposedPorts": {"3306/tcp": {}},
+		"Env": ["PATH=/usr/bin", "MYSQL_ROOT_PASSWORD=secret"],
+		"Volumes": {"/var/lib/mysql": {}}
+	}
+}]`
+
+func TestNewTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmx-new")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	inspect := filepath.Join(dir, "mysql.json")
+	ioutil.WriteFile(inspect, []byte(dockerInspectOutput), 0600)
+	path := filepath.Join(dir, "wordpress-with-mysql.pmx")
+
+	o, err := NewTemplate("Wordpress with MySQL", NewTemplateOptions{
+		Description:  "Wordpress linked to MySQL",
+		Images:       []string{"wp=centurylink/wordpress:3.9.1"},
+		InspectPaths: []string{inspect},
+		Ports:        []string{"wp=8080:80"},
+		Environment:  []string{"wp=DB_PASSWORD=secret"},
+		Links:        []string{"wp=mysql:DB_1"},
+		Output:       path,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Wrote template 'Wordpress with MySQL' with 2 image(s) to '"+path+"'", o.ToPrettyOutput())
+
+	tpl, err := template.Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "Wordpress linked to MySQL", tpl.Description)
+	assert.Contains(t, tpl.Documentation, "Wordpress with MySQL\n====")
+	if assert.Len(t, tpl.Images, 2) {
+		db := tpl.Images[0]
+		assert.Equal(t, "mysql", db.Name)
+		assert.Equal(t, "centurylink/mysql:5.5", db.Source)
+		assert.Equal(t, []template.Port{{HostPort: 3306, ContainerPort: 3306, Protocol: "TCP"}}, db.Ports)
+		assert.Equal(t, []template.Environment{{Variable: "MYSQL_ROOT_PASSWORD", Value: "secret"}}, db.Environment)
+		assert.Equal(t, []template.Volume{{ContainerPath: "/var/lib/mysql"}}, db.Volumes)
+
+		wp := tpl.Images[1]
+		assert.Equal(t, []template.Port{{HostPort: 8080, ContainerPort: 80}}, wp.Ports)
+		assert.Equal(t, []template.Environment{{Variable: "DB_PASSWORD", Value: "secret"}}, wp.Environment)
+		assert.Equal(t, []template.Link{{Service: "mysql", Alias: "DB_1"}}, wp.Links)
+	}
+
+	_, err = NewTemplate("Wordpress with MySQL", NewTemplateOptions{Images: []string{"wordpress"}, Output: path})
+	assert.EqualError(t, err, "'"+path+"' already exists, use --force to overwrite it")
+	_, err = NewTemplate("Wordpress with MySQL", NewTemplateOptions{Images: []string{"wordpress"}, Output: path, Force: true})
+	assert.NoError(t, err)
+}
+
+func TestNewTemplateWithProblems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmx-new")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "web.pmx")
+
+	o, err := NewTemplate("Web", NewTemplateOptions{Images: []string{"web=nginx"}, Links: []string{"web=db:DB"}, Output: path})
+	assert.NoError(t, err)
+	assert.Equal(t, "Wrote template 'Web' with 1 image(s) to '"+path+"'\n\n"+
+		"PROBLEMS\n"+
+		"'web' links to 'db', which is not in the template", o.ToPrettyOutput())
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+}
+
+func TestNewTemplateInteractive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmx-new")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "redis.pmx")
+	in := strings.NewReader("\ncache\nredis:3\n\n6379\n\nMODE=cache\nALLOWED_HOSTS=a.com,b.com\n\n\n/data\n\n\n")
+	var out bytes.Buffer
+
+	_, err = NewTemplate("Redis", NewTemplateOptions{Description: "Key-value store", Keywords: "nosql", Interactive: true, In: in, Out: &out, Output: path})
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Description [Key-value store]: ")
+	assert.Contains(t, out.String(), "Image name [redis]: ")
+
+	tpl, err := template.Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "Key-value store", tpl.Description)
+	assert.Equal(t, "cache", tpl.Keywords)
+	if assert.Len(t, tpl.Images, 1) {
+		i := tpl.Images[0]
+		assert.Equal(t, "redis", i.Name)
+		assert.Equal(t, "redis:3", i.Source)
+		assert.Equal(t, []template.Port{{HostPort: 6379, ContainerPort: 6379}}, i.Ports)
+		assert.Equal(t, []template.Environment{{Variable: "MODE", Value: "cache"}, {Variable: "ALLOWED_HOSTS", Value: "a.com,b.com"}}, i.Environment)
+		assert.Equal(t, []template.Volume{{ContainerPath: "/data"}}, i.Volumes)
+	}
+}
+
+func TestErroredNewTemplate(t *testing.T) {
+	_, err := NewTemplate("Empty", NewTemplateOptions{})
+	assert.EqualError(t, err, "the template needs at least one image")
+
+	_, err = NewTemplate("Test", NewTemplateOptions{Images: []string{"a=a", "b=b"}, Ports: []string{"80"}})
+	assert.EqualError(t, err, "'80' must start with the name of one of the template's images, as in 'IMAGE=VALUE'")
+
+	_, err = NewTemplate("Test", NewTemplateOptions{Images: []string{"a"}, Ports: []string{"http"}})
+	assert.EqualError(t, err, "'http' is not a port, use HOST:CONTAINER")
+
+	inspect := setupTemplateFile(t, "{}")
+	defer os.Remove(inspect)
+	_, err = NewTemplate("Test", NewTemplateOptions{InspectPaths: []string{inspect}})
+	assert.Contains(t, err.Error(), "is not the output of docker inspect")
+}
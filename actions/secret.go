@@ -0,0 +1,170 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/panamaxcli/secret"
+	"github.com/CenturyLinkLabs/prettycli"
+)
+
+// DefaultSecretStore resolves the secret:// references in templates as they
+// are deployed. Templates with references can't be deployed when it is nil.
+var DefaultSecretStore secret.Store
+
+var errNoSecretStore = errors.New("no secret store is configured, see 'pmxcli secret store'")
+
+// OpenSecretStore returns the store described by s. The passphrase for an
+// encrypted file is read from the environment.
+func OpenSecretStore(s config.SecretStore) secret.Store {
+	switch s.Backend {
+	case config.SecretBackendFile:
+		return secret.File{Path: s.Path, Passphrase: os.Getenv(secret.PassphraseEnv)}
+	case config.SecretBackendExec:
+		return secret.Exec{Command: s.Command}
+	default:
+		return secret.Dir{Path: s.Path}
+	}
+}
+
+// createDeployment deploys the blueprint with its secret references resolved.
+// Only the client sees the values, so the blueprint, and the templates it
+// came from, can be shown and recorded in the journal.
+func createDeployment(c client.Client, bp agent.DeploymentBlueprint) (agent.DeploymentResponseLite, error) {
+	resolved, err := resolveSecrets(bp)
+	if err != nil {
+		return agent.DeploymentResponseLite{}, err
+	}
+	return c.CreateDeployment(resolved)
+}
+
+// resolveSecrets returns a copy of the blueprint with each environment
+// variable that refers to a secret set to its value.
+func resolveSecrets(bp agent.DeploymentBlueprint) (agent.DeploymentBlueprint, error) {
+	var err error
+	if bp.Template.Images, err = resolveImageSecrets(bp.Template.Images); err != nil {
+		return bp, err
+	}
+	if bp.Override.Images, err = resolveImageSecrets(bp.Override.Images); err != nil {
+		return bp, err
+	}
+	return bp, nil
+}
+
+func resolveImageSecrets(images []agent.Image) ([]agent.Image, error) {
+	if images == nil {
+		return nil, nil
+	}
+
+	resolved := make([]agent.Image, len(images))
+	for n, i := range images {
+		resolved[n] = i
+		if i.Environment == nil {
+			continue
+		}
+		resolved[n].Environment = make([]agent.Environment, len(i.Environment))
+		for m, e := range i.Environment {
+			if _, ok := secret.Reference(e.Value); ok {
+				if DefaultSecretStore == nil {
+					return nil, fmt.Errorf("'%s' in image '%s' refers to a secret, but %s", e.Variable, i.Name, errNoSecretStore)
+				}
+				value, err := secret.Resolve(DefaultSecretStore, e.Value)
+				if err != nil {
+					return nil, fmt.Errorf("'%s' in image '%s': %s", e.Variable, i.Name, err)
+				}
+				e.Value = value
+			}
+			resolved[n].Environment[m] = e
+		}
+	}
+	return resolved, nil
+}
+
+// SetSecretStore configures where secrets are read from: a directory with a
+// file for each secret, an encrypted file, or a helper command.
+func SetSecretStore(c config.Config, backend string, location string) (prettycli.Output, error) {
+	s := config.SecretStore{Backend: backend}
+	if backend == config.SecretBackendExec {
+		s.Command = location
+	} else if location != "" {
+		abs, err := filepath.Abs(location)
+		if err != nil {
+			return prettycli.PlainOutput{}, err
+		}
+		s.Path = abs
+	}
+	if err := c.SetSecretStore(s); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	switch backend {
+	case config.SecretBackendFile:
+		return prettycli.PlainOutput{fmt.Sprintf("Secrets will be read from the encrypted file '%s', using the passphrase in %s", s.Path, secret.PassphraseEnv)}, nil
+	case config.SecretBackendExec:
+		return prettycli.PlainOutput{fmt.Sprintf("Secrets will be looked up by running '%s'", s.Command)}, nil
+	default:
+		return prettycli.PlainOutput{fmt.Sprintf("Secrets will be read from the directory '%s'", s.Path)}, nil
+	}
+}
+
+// SetSecret adds or changes a secret in the store.
+func SetSecret(name string, value string) (prettycli.Output, error) {
+	s, err := writableSecretStore()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if err := s.Set(name, strings.TrimRight(value, "\r\n")); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("Set secret '%s', use it as '%s%s'", name, secret.Scheme, name)}, nil
+}
+
+func RemoveSecret(name string) (prettycli.Output, error) {
+	s, err := writableSecretStore()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if err := s.Remove(name); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	return prettycli.PlainOutput{fmt.Sprintf("Removed secret '%s'", name)}, nil
+}
+
+// ListSecrets lists the names of the secrets in the store, but never their
+// values.
+func ListSecrets() (prettycli.Output, error) {
+	s, err := writableSecretStore()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	names, err := s.Names()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if len(names) == 0 {
+		return prettycli.PlainOutput{"No secrets"}, nil
+	}
+
+	o := prettycli.ListOutput{Labels: []string{"Name", "Reference"}}
+	for _, n := range names {
+		o.AddRow(map[string]string{"Name": n, "Reference": secret.Scheme + n})
+	}
+	return &o, nil
+}
+
+func writableSecretStore() (secret.WritableStore, error) {
+	if DefaultSecretStore == nil {
+		return nil, errNoSecretStore
+	}
+	s, ok := DefaultSecretStore.(secret.WritableStore)
+	if !ok {
+		return nil, errors.New("secrets can only be changed in a dir or file secret store, use the helper command to manage them instead")
+	}
+	return s, nil
+}
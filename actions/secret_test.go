@@ -0,0 +1,133 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/panamaxcli/secret"
+	"github.com/CenturyLinkLabs/prettycli"
+	"github.com/stretchr/testify/assert"
+)
+
+var secretTemplate = `
+name: Wordpress
+images:
+- name: WP
+  source: centurylink/wordpress:3.9.1
+  environment:
+  - variable: DB_PASSWORD
+    value: secret://db/password
+  - variable: DEBUG
+    value: "false"
+`
+
+func setupSecretStore(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pmx-secrets")
+	assert.NoError(t, err)
+	DefaultSecretStore = secret.Dir{Path: dir}
+	return dir
+}
+
+func TestCreateDeploymentResolvesSecrets(t *testing.T) {
+	setupFactory()
+	j := setupJournal()
+	dir := setupSecretStore(t)
+	defer os.RemoveAll(dir)
+	defer func() { DefaultSecretStore = nil }()
+	SetSecret("db/password", "pass@word01\n")
+	path := setupTemplateFile(t, secretTemplate)
+	defer os.Remove(path)
+	fakeClient.DeployedDeployment = agent.DeploymentResponseLite{ID: 1}
+
+	_, err := CreateDeployment(config.Remote{Name: "Test"}, path)
+	assert.NoError(t, err)
+	env := fakeClient.DeployedBlueprint.Template.Images[0].Environment
+	assert.Equal(t, []agent.Environment{{Variable: "DB_PASSWORD", Value: "pass@word01"}, {Variable: "DEBUG", Value: "false"}}, env)
+	assert.Equal(t, "password is *****", secret.Redact("password is pass@word01"))
+	if assert.Len(t, j.Recorded, 1) {
+		recorded := string(j.Templates[j.Recorded[0].TemplateHash])
+		assert.Contains(t, recorded, "secret://db/password")
+		assert.NotContains(t, recorded, "pass@word01")
+	}
+}
+
+func TestErroredCreateDeploymentSecrets(t *testing.T) {
+	setupFactory()
+	path := setupTemplateFile(t, secretTemplate)
+	defer os.Remove(path)
+
+	_, err := CreateDeployment(config.Remote{Name: "Test"}, path)
+	assert.EqualError(t, err, "'DB_PASSWORD' in image 'WP' refers to a secret, but no secret store is configured, see 'pmxcli secret store'")
+
+	dir := setupSecretStore(t)
+	defer os.RemoveAll(dir)
+	defer func() { DefaultSecretStore = nil }()
+	_, err = CreateDeployment(config.Remote{Name: "Test"}, path)
+	assert.EqualError(t, err, "'DB_PASSWORD' in image 'WP': secret 'db/password' does not exist")
+	assert.Empty(t, fakeClient.DeployedBlueprint.Template.Images)
+}
+
+func TestResolveSecretsCopiesBlueprint(t *testing.T) {
+	DefaultSecretStore = secret.Exec{Command: "echo resolved"}
+	defer func() { DefaultSecretStore = nil }()
+	bp := agent.DeploymentBlueprint{Template: agent.Template{Images: []agent.Image{
+		{Name: "a", Environment: []agent.Environment{{Variable: "A", Value: "secret://a"}}},
+	}}}
+
+	resolved, err := resolveSecrets(bp)
+	assert.NoError(t, err)
+	assert.Equal(t, "resolved a", resolved.Template.Images[0].Environment[0].Value)
+	assert.Equal(t, "secret://a", bp.Template.Images[0].Environment[0].Value)
+}
+
+func TestSetSecretStore(t *testing.T) {
+	fc := &FakeConfig{}
+
+	o, err := SetSecretStore(fc, config.SecretBackendExec, "pass show")
+	assert.NoError(t, err)
+	assert.Equal(t, "Secrets will be looked up by running 'pass show'", o.ToPrettyOutput())
+	assert.Equal(t, &config.SecretStore{Backend: config.SecretBackendExec, Command: "pass show"}, fc.Secrets)
+
+	o, err = SetSecretStore(fc, config.SecretBackendDir, "/secrets")
+	assert.NoError(t, err)
+	assert.Equal(t, "Secrets will be read from the directory '/secrets'", o.ToPrettyOutput())
+
+	assert.Equal(t, secret.File{Path: "/secrets.enc"}, OpenSecretStore(config.SecretStore{Backend: config.SecretBackendFile, Path: "/secrets.enc"}))
+}
+
+func TestSecretCommands(t *testing.T) {
+	dir := setupSecretStore(t)
+	defer os.RemoveAll(dir)
+	defer func() { DefaultSecretStore = nil }()
+
+	o, err := ListSecrets()
+	assert.NoError(t, err)
+	assert.Equal(t, "No secrets", o.ToPrettyOutput())
+
+	o, err = SetSecret("db/password", "pass@word01")
+	assert.NoError(t, err)
+	assert.Equal(t, "Set secret 'db/password', use it as 'secret://db/password'", o.ToPrettyOutput())
+
+	o, err = ListSecrets()
+	assert.NoError(t, err)
+	lo := o.(*prettycli.ListOutput)
+	assert.Equal(t, []map[string]string{{"Name": "db/password", "Reference": "secret://db/password"}}, lo.Rows)
+	assert.NotContains(t, o.ToPrettyOutput(), "pass@word01")
+
+	o, err = RemoveSecret("db/password")
+	assert.NoError(t, err)
+	assert.Equal(t, "Removed secret 'db/password'", o.ToPrettyOutput())
+}
+
+func TestErroredSecretCommands(t *testing.T) {
+	_, err := SetSecret("a", "b")
+	assert.EqualError(t, err, "no secret store is configured, see 'pmxcli secret store'")
+
+	DefaultSecretStore = secret.Exec{Command: "echo"}
+	defer func() { DefaultSecretStore = nil }()
+	_, err = ListSecrets()
+	assert.Contains(t, err.Error(), "secrets can only be changed in a dir or file secret store")
+}
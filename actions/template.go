@@ -0,0 +1,277 @@
+package actions
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/template"
+	"github.com/CenturyLinkLabs/prettycli"
+)
+
+// maskedValue replaces environment variable values when they are masked.
+const maskedValue = "*****"
+
+// parseTemplate reads a template in the complete Panamax format and converts
+// it to the agent's model.
+func parseTemplate(b []byte, t *agent.Template) error {
+	tpl, err := template.Parse(b)
+	if err != nil {
+		return err
+	}
+	*t = tpl.AgentTemplate()
+	return nil
+}
+
+// readTemplateFile reads the template at path with the images of any
+// templates it includes merged in, so that what's deployed and recorded in
+// the journal doesn't depend on other files. Templates without includes are
+// returned as they're written, and ones that can't be parsed are left for the
+// caller to report.
+func readTemplateFile(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if t, err := template.Parse(b); err != nil || len(t.Include) == 0 {
+		return b, nil
+	}
+
+	t, err := template.Resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return t.Marshal()
+}
+
+// RenderTemplate outputs the template at path as it will be deployed, with
+// the images of the templates it includes merged in.
+func RenderTemplate(path string) (prettycli.Output, error) {
+	t, err := template.Resolve(path)
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	b, err := t.Marshal()
+	if err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	return prettycli.PlainOutput{strings.TrimRight(string(b), "\n")}, nil
+}
+
+// A templateChange is a single difference between two templates.
+type templateChange struct {
+	Image  string
+	Field  string
+	Before string
+	After  string
+}
+
+// DiffTemplates compares the templates at paths a and b by what they deploy
+// rather than by their text, so the order of images, environment variables,
+// ports and so on is ignored. With maskValues, environment variable values
+// are hidden, though changes to them are still reported.
+func DiffTemplates(a string, b string, maskValues bool) (prettycli.Output, error) {
+	var before, after agent.Template
+	if err := readTemplate(a, &before); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+	if err := readTemplate(b, &after); err != nil {
+		return prettycli.PlainOutput{}, err
+	}
+
+	changes := diffTemplates(before, after, maskValues)
+	if len(changes) == 0 {
+		return prettycli.PlainOutput{"The templates are equivalent"}, nil
+	}
+
+	o := prettycli.ListOutput{Labels: []string{"Image", "Field", "Before", "After"}}
+	for _, c := range changes {
+		o.AddRow(map[string]string{
+			"Image":  c.Image,
+			"Field":  c.Field,
+			"Before": c.Before,
+			"After":  c.After,
+		})
+	}
+	return &o, nil
+}
+
+func diffTemplates(a agent.Template, b agent.Template, maskValues bool) []templateChange {
+	var changes []templateChange
+	if a.Name != b.Name {
+		changes = append(changes, templateChange{Field: "name", Before: a.Name, After: b.Name})
+	}
+
+	before, after := imagesByName(a), imagesByName(b)
+	var names []string
+	for n := range before {
+		names = append(names, n)
+	}
+	for n := range after {
+		if _, ok := before[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		bi, inBefore := before[n]
+		ai, inAfter := after[n]
+		switch {
+		case !inBefore:
+			changes = append(changes, templateChange{Image: n, Field: "image", After: "added"})
+		case !inAfter:
+			changes = append(changes, templateChange{Image: n, Field: "image", Before: "removed"})
+		default:
+			changes = append(changes, diffImages(bi, ai, maskValues)...)
+		}
+	}
+	return changes
+}
+
+func imagesByName(t agent.Template) map[string]agent.Image {
+	images := make(map[string]agent.Image)
+	for _, i := range t.Images {
+		images[i.Name] = i
+	}
+	return images
+}
+
+func diffImages(a agent.Image, b agent.Image, maskValues bool) []templateChange {
+	var changes []templateChange
+	field := func(name string, before string, after string) {
+		if before != after {
+			changes = append(changes, templateChange{Image: a.Name, Field: name, Before: before, After: after})
+		}
+	}
+
+	field("source", a.Source, b.Source)
+	field("command", a.Command, b.Command)
+	field("count", countString(a.Deployment.Count), countString(b.Deployment.Count))
+
+	ae, be := environmentByVariable(a), environmentByVariable(b)
+	for _, v := range unionKeys(ae, be) {
+		before, inBefore := ae[v]
+		after, inAfter := be[v]
+		if inBefore == inAfter && before == after {
+			continue
+		}
+		if maskValues {
+			before, after = maskedValue, maskedValue
+		}
+		c := templateChange{Image: a.Name, Field: "environment " + v, Before: before, After: after}
+		if !inBefore {
+			c.Before = ""
+		}
+		if !inAfter {
+			c.After = ""
+		}
+		changes = append(changes, c)
+	}
+
+	sets := []struct {
+		name   string
+		before []string
+		after  []string
+	}{
+		{"ports", portStrings(a), portStrings(b)},
+		{"expose", exposeStrings(a), exposeStrings(b)},
+		{"links", linkStrings(a), linkStrings(b)},
+		{"volumes", volumeStrings(a), volumeStrings(b)},
+		{"volumes_from", a.VolumesFrom, b.VolumesFrom},
+	}
+	for _, s := range sets {
+		removed, added := setDifference(s.before, s.after), setDifference(s.after, s.before)
+		for _, r := range removed {
+			changes = append(changes, templateChange{Image: a.Name, Field: s.name, Before: r})
+		}
+		for _, ad := range added {
+			changes = append(changes, templateChange{Image: a.Name, Field: s.name, After: ad})
+		}
+	}
+
+	return changes
+}
+
+func countString(c agent.FromIntOrString) string {
+	if c.Value == 0 {
+		return ""
+	}
+	return strconv.Itoa(c.Value)
+}
+
+func environmentByVariable(i agent.Image) map[string]string {
+	env := make(map[string]string)
+	for _, e := range i.Environment {
+		env[e.Variable] = e.Value
+	}
+	return env
+}
+
+func unionKeys(a map[string]string, b map[string]string) []string {
+	var keys []string
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func portStrings(i agent.Image) []string {
+	var ports []string
+	for _, p := range i.Ports {
+		ports = append(ports, fmt.Sprintf("%d:%d", p.HostPort.Value, p.ContainerPort.Value))
+	}
+	return ports
+}
+
+func exposeStrings(i agent.Image) []string {
+	var expose []string
+	for _, e := range i.Expose {
+		expose = append(expose, strconv.Itoa(e.Value))
+	}
+	return expose
+}
+
+func linkStrings(i agent.Image) []string {
+	var links []string
+	for _, l := range i.Links {
+		links = append(links, l.Service+":"+l.Alias)
+	}
+	return links
+}
+
+func volumeStrings(i agent.Image) []string {
+	var volumes []string
+	for _, v := range i.Volumes {
+		volumes = append(volumes, v.HostPath+":"+v.ContainerPath)
+	}
+	return volumes
+}
+
+// setDifference returns the sorted values in a that aren't in b.
+func setDifference(a []string, b []string) []string {
+	inB := make(map[string]bool)
+	for _, v := range b {
+		inB[v] = true
+	}
+
+	var diff []string
+	seen := make(map[string]bool)
+	for _, v := range a {
+		if !inB[v] && !seen[v] {
+			seen[v] = true
+			diff = append(diff, v)
+		}
+	}
+	sort.Strings(diff)
+	return diff
+}
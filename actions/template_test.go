@@ -0,0 +1,181 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/prettycli"
+	"github.com/stretchr/testify/assert"
+)
+
+var diffBefore = `
+name: Stack
+images:
+- name: web
+  source: nginx:1.7
+  environment:
+  - variable: MODE
+    value: prod
+  - variable: SECRET
+    value: old
+  ports:
+  - host_port: 80
+    container_port: 80
+  - host_port: 443
+    container_port: 443
+  links:
+  - service: db
+    alias: db
+- name: db
+  source: mysql:5.6
+  volumes:
+  - host_path: /data
+    container_path: /var/lib/mysql
+- name: cache
+  source: redis
+`
+
+var diffAfter = `
+name: Stack
+images:
+- name: db
+  source: mysql:5.6
+  volumes:
+  - container_path: /var/lib/mysql
+    host_path: /data
+- name: web
+  source: nginx:1.9
+  deployment:
+    count: 2
+  environment:
+  - variable: SECRET
+    value: new
+  - variable: MODE
+    value: prod
+  - variable: DEBUG
+    value: "false"
+  ports:
+  - host_port: 443
+    container_port: 443
+  - host_port: 8080
+    container_port: 80
+  links:
+  - service: db
+    alias: db
+- name: queue
+  source: rabbitmq
+`
+
+func setupDiff(t *testing.T) (string, string) {
+	return setupTemplateFile(t, diffBefore), setupTemplateFile(t, diffAfter)
+}
+
+func TestDiffTemplates(t *testing.T) {
+	a, b := setupDiff(t)
+	defer os.Remove(a)
+	defer os.Remove(b)
+
+	o, err := DiffTemplates(a, b, false)
+	assert.NoError(t, err)
+	lo := o.(*prettycli.ListOutput)
+	assert.Equal(t, []map[string]string{
+		{"Image": "cache", "Field": "image", "Before": "removed", "After": ""},
+		{"Image": "queue", "Field": "image", "Before": "", "After": "added"},
+		{"Image": "web", "Field": "source", "Before": "nginx:1.7", "After": "nginx:1.9"},
+		{"Image": "web", "Field": "count", "Before": "", "After": "2"},
+		{"Image": "web", "Field": "environment DEBUG", "Before": "", "After": "false"},
+		{"Image": "web", "Field": "environment SECRET", "Before": "old", "After": "new"},
+		{"Image": "web", "Field": "ports", "Before": "80:80", "After": ""},
+		{"Image": "web", "Field": "ports", "Before": "", "After": "8080:80"},
+	}, lo.Rows)
+}
+
+func TestMaskedDiffTemplates(t *testing.T) {
+	a, b := setupDiff(t)
+	defer os.Remove(a)
+	defer os.Remove(b)
+
+	o, err := DiffTemplates(a, b, true)
+	assert.NoError(t, err)
+	for _, r := range o.(*prettycli.ListOutput).Rows {
+		if r["Field"] == "environment SECRET" {
+			assert.Equal(t, "*****", r["Before"])
+			assert.Equal(t, "*****", r["After"])
+		}
+		if r["Field"] == "environment DEBUG" {
+			assert.Equal(t, "", r["Before"])
+			assert.Equal(t, "*****", r["After"])
+		}
+	}
+}
+
+func TestEquivalentDiffTemplates(t *testing.T) {
+	a := setupTemplateFile(t, diffBefore)
+	defer os.Remove(a)
+
+	o, err := DiffTemplates(a, a, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "The templates are equivalent", o.ToPrettyOutput())
+}
+
+func TestErroredDiffTemplates(t *testing.T) {
+	a := setupTemplateFile(t, diffBefore)
+	defer os.Remove(a)
+
+	o, err := DiffTemplates(a, "/nonexistant.pmx", false)
+	assert.Error(t, err)
+	assert.Equal(t, prettycli.PlainOutput{}, o)
+}
+
+func setupIncludingTemplate(t *testing.T) (string, string) {
+	dir, err := ioutil.TempDir("", "pmx-include")
+	assert.NoError(t, err)
+	ioutil.WriteFile(filepath.Join(dir, "redis.pmx"), []byte("name: Redis\nimages:\n- name: redis\n  source: redis:3\n"), 0600)
+	path := filepath.Join(dir, "stack.pmx")
+	ioutil.WriteFile(path, []byte("name: Stack\ninclude:\n- redis.pmx\nimages:\n- name: web\n  source: nginx\n"), 0600)
+	return dir, path
+}
+
+func TestRenderTemplate(t *testing.T) {
+	dir, path := setupIncludingTemplate(t)
+	defer os.RemoveAll(dir)
+
+	o, err := RenderTemplate(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Stack\nimages:\n- name: web\n  source: nginx\n- name: redis\n  source: redis:3", o.ToPrettyOutput())
+
+	_, err = RenderTemplate("/nonexistant.pmx")
+	assert.Error(t, err)
+}
+
+func TestCreateDeploymentWithIncludes(t *testing.T) {
+	setupFactory()
+	j := setupJournal()
+	dir, path := setupIncludingTemplate(t)
+	defer os.RemoveAll(dir)
+	fakeClient.DeployedDeployment = agent.DeploymentResponseLite{ID: 1}
+
+	_, err := CreateDeployment(config.Remote{Name: "Test"}, path)
+	assert.NoError(t, err)
+	assert.Len(t, fakeClient.DeployedBlueprint.Template.Images, 2)
+	if assert.Len(t, j.Recorded, 1) {
+		assert.NotContains(t, string(j.Templates[j.Recorded[0].TemplateHash]), "include")
+	}
+}
+
+func TestCreateDeploymentWithEmptyNumbers(t *testing.T) {
+	setupFactory()
+	path := setupTemplateFile(t, "name: Test\nimages:\n- name: a\n  source: a:1\n  deployment:\n    count: \"\"\n  ports:\n  - host_port: \"\"\n    container_port: 80\n")
+	defer os.Remove(path)
+
+	_, err := CreateDeployment(config.Remote{Name: "Test"}, path)
+	assert.NoError(t, err)
+	i := fakeClient.DeployedBlueprint.Template.Images[0]
+	assert.Equal(t, 0, i.Deployment.Count.Value)
+	assert.Equal(t, 0, i.Ports[0].HostPort.Value)
+	assert.Equal(t, 80, i.Ports[0].ContainerPort.Value)
+}
@@ -0,0 +1,17 @@
+package actions
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Warnings is where warnings about things the user should know, but that
+// don't stop a command, are written. Unlike the log, it isn't filtered by the
+// log level, and it's kept apart from the command's output so that output can
+// still be piped.
+var Warnings io.Writer = os.Stderr
+
+func warnf(format string, args ...interface{}) {
+	fmt.Fprintf(Warnings, "Warning: "+format+"\n", args...)
+}
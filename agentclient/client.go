@@ -0,0 +1,362 @@
+// Package agentclient talks to a Panamax remote agent. It implements the same
+// client.Client interface as the agent's own client, and logs and fails in
+// the same way, but each client can be configured separately, such as with
+// timeouts that differ between remotes and between the calls that read from
+// the agent and the ones that change things on it, and it retries calls that
+// fail for reasons that are likely to pass.
+package agentclient
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/api"
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+	log "github.com/Sirupsen/logrus"
+)
+
+// Timeouts limit how long a call to the agent may take. Calls that change
+// things, like creating a deployment, can take much longer than calls that
+// only read from the agent, because the adapter does its work before the
+// agent responds.
+type Timeouts struct {
+	Read   time.Duration
+	Mutate time.Duration
+}
+
+// DefaultTimeouts are used for remotes without their own timeouts.
+var DefaultTimeouts = Timeouts{Read: 10 * time.Second, Mutate: 2 * time.Minute}
+
+// A TimeoutError is returned when the agent doesn't respond in time. For a
+// call that changes something, the change may still have happened.
+type TimeoutError struct {
+	Method  string
+	URL     string
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	if e.Method == "GET" {
+		return fmt.Sprintf("the agent didn't respond to %s %s within %s", e.Method, e.URL, e.Timeout)
+	}
+	return fmt.Sprintf("the agent didn't respond to %s %s within %s, so it may or may not have happened; check the deployments before trying again, or allow longer with --timeout", e.Method, e.URL, e.Timeout)
+}
+
+// Direct is the Proxy setting for clients that never use a proxy, whatever
+// the environment says.
+const Direct = "direct"
+
+// Client implements the client.Client interface and communicates with the
+// agent over HTTPS.
+type Client struct {
+	Endpoint   string
+	Username   string
+	Password   string
+	PrivateKey string
+	Timeouts   Timeouts
+	// Retry is the zero value for clients that use the default policy.
+	Retry RetryPolicy
+	// Proxy is the URL of the proxy to connect through, or Direct. When it
+	// is empty, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment
+	// variables decide.
+	Proxy string
+	// CAFiles are PEM files of certificates to trust besides the one in the
+	// token, e.g. for agents whose certificates were re-issued by an internal
+	// CA.
+	CAFiles []string
+	// ClientCert and ClientKey are the PEM files of a certificate and key to
+	// present to the agent, or to a TLS-terminating proxy in front of it that
+	// requires client certificates.
+	ClientCert string
+	ClientKey  string
+	// WrapTransport, when set, is given the transport the client built and
+	// returns the one to use instead, e.g. to trace requests, or to record
+	// and replay them in tests.
+	WrapTransport func(http.RoundTripper) http.RoundTripper
+
+	// The transport is built on the first call and reused after it, so that
+	// connections to the agent are kept alive between calls. The settings
+	// above can't be changed after that.
+	mutex     sync.Mutex
+	transport http.RoundTripper
+}
+
+// ListDeployments fetches a list of deployments.
+func (c *Client) ListDeployments() ([]agent.DeploymentResponseLite, error) {
+	var deployments []agent.DeploymentResponseLite
+	err := c.doRequest("GET", api.URLForDeployments(), &deployments, nil)
+	return deployments, err
+}
+
+// GetMetadata fetches metadata for the agent and adapter.
+func (c *Client) GetMetadata() (agent.Metadata, error) {
+	var metadata agent.Metadata
+	err := c.doRequest("GET", api.URLForMetadata(), &metadata, nil)
+	return metadata, err
+}
+
+// DescribeDeployment fetches details for a specific deployment.
+func (c *Client) DescribeDeployment(id string) (agent.DeploymentResponseFull, error) {
+	var resp agent.DeploymentResponseFull
+	err := c.doRequest("GET", api.URLForDeploymentID(id), &resp, nil)
+	return resp, err
+}
+
+// CreateDeployment creates a new deployment from a blueprint.
+func (c *Client) CreateDeployment(b agent.DeploymentBlueprint) (agent.DeploymentResponseLite, error) {
+	var resp agent.DeploymentResponseLite
+	err := c.doRequest("POST", api.URLForDeployments(), &resp, b)
+	return resp, err
+}
+
+// RedeployDeployment redeploys a specific deployment.
+func (c *Client) RedeployDeployment(id string) (agent.DeploymentResponseLite, error) {
+	var deployment agent.DeploymentResponseLite
+	err := c.doRequest("POST", api.RedeploymentURLForDeploymentID(id), &deployment, nil)
+	return deployment, err
+}
+
+// DeleteDeployment deletes a specific deployment.
+func (c *Client) DeleteDeployment(id string) error {
+	return c.doRequest("DELETE", api.URLForDeploymentID(id), nil, nil)
+}
+
+func (c *Client) timeout(method string) time.Duration {
+	t := DefaultTimeouts.Read
+	if c.Timeouts.Read > 0 {
+		t = c.Timeouts.Read
+	}
+	if method != "GET" {
+		t = DefaultTimeouts.Mutate
+		if c.Timeouts.Mutate > 0 {
+			t = c.Timeouts.Mutate
+		}
+	}
+	return t
+}
+
+func (c *Client) retryPolicy() RetryPolicy {
+	if c.Retry.MaxAttempts > 0 {
+		return c.Retry
+	}
+	return DefaultRetryPolicy
+}
+
+func (c *Client) doRequest(method string, urn string, o interface{}, p interface{}) error {
+	timeout := c.timeout(method)
+	transport, err := c.Transport()
+	if err != nil {
+		return err
+	}
+	httpClient := &http.Client{Timeout: timeout, Transport: transport}
+	policy := c.retryPolicy()
+
+	var params []byte
+	if p != nil {
+		j, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		params = j
+	}
+
+	url := c.Endpoint + urn
+	var status int
+	var body []byte
+	for attempt := 1; ; attempt++ {
+		status, body, err = c.send(httpClient, method, url, params, timeout, fmt.Sprintf("%d/%d", attempt, policy.MaxAttempts))
+		reason := retryReason(method, status, err)
+		if reason == "" || attempt >= policy.MaxAttempts {
+			break
+		}
+
+		delay := policy.delay(attempt)
+		log.WithFields(log.Fields{
+			"URL":    url,
+			"Method": method,
+			"Reason": reason,
+			"Delay":  delay.String(),
+			"Policy": policy.String(),
+		}).Info("Retrying request")
+		sleep(delay)
+	}
+
+	if err != nil {
+		if isTimeout(err) {
+			return TimeoutError{Method: method, URL: url, Timeout: timeout}
+		}
+		return err
+	}
+	if status >= 400 {
+		return client.RequestError{StatusCode: status, Body: string(body)}
+	}
+
+	if o == nil {
+		return nil
+	}
+	return json.Unmarshal(body, &o)
+}
+
+// send makes a single attempt at the request, returning the response's
+// status and body.
+func (c *Client) send(httpClient *http.Client, method string, url string, params []byte, timeout time.Duration, attempt string) (int, []byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(params))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+	req.SetBasicAuth(c.Username, c.Password)
+
+	log.WithFields(log.Fields{
+		"URL":     url,
+		"Method":  method,
+		"Body":    string(params),
+		"Timeout": timeout.String(),
+		"Attempt": attempt,
+	}).Info("Making request")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var prettyJSON bytes.Buffer
+	json.Indent(&prettyJSON, body, " ", "  ")
+	log.WithFields(log.Fields{
+		"Status": resp.StatusCode,
+		"Body":   prettyJSON.String(),
+	}).Info("Received Response")
+
+	return resp.StatusCode, body, nil
+}
+
+// Transport returns the transport that the client's calls share, building it
+// on the first call.
+func (c *Client) Transport() (http.RoundTripper, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.transport != nil {
+		return c.transport, nil
+	}
+
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:               c.proxy,
+		TLSClientConfig:     tlsConfig,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if c.WrapTransport != nil {
+		transport = c.WrapTransport(transport)
+	}
+	c.transport = transport
+	return transport, nil
+}
+
+// TLSConfig returns the configuration for connections to the agent: the
+// certificates to trust and the one to present, if any.
+func (c *Client) TLSConfig() (*tls.Config, error) {
+	pool, err := CertPool(c.PrivateKey, c.CAFiles)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		RootCAs:            pool,
+		InsecureSkipVerify: client.SkipSSLVerify,
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := ClientCertificate(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// ClientCertificate loads a client certificate and its key from PEM files.
+func ClientCertificate(certFile string, keyFile string) (tls.Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return tls.Certificate{}, errors.New("a client certificate needs both a certificate and a key file")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("the client certificate could not be loaded: %s", err)
+	}
+	return cert, nil
+}
+
+// ProxyFor returns the proxy that requests to the endpoint go through, or
+// nil when they connect directly.
+func (c *Client) ProxyFor(endpoint string) (*url.URL, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.proxy(req)
+}
+
+func (c *Client) proxy(req *http.Request) (*url.URL, error) {
+	switch c.Proxy {
+	case "":
+		return http.ProxyFromEnvironment(req)
+	case Direct:
+		return nil, nil
+	default:
+		return ParseProxy(c.Proxy)
+	}
+}
+
+// ParseProxy parses a proxy URL, which needs a scheme and a host.
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+		return nil, fmt.Errorf("'%s' is not a proxy URL, use e.g. 'http://proxy.example.com:3128'", proxy)
+	}
+	return u, nil
+}
+
+// CertPool returns the certificates to trust: the one in the token and every
+// one in the CA files.
+func CertPool(tokenCert string, caFiles []string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM([]byte(tokenCert))
+	for _, f := range caFiles {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("the CA bundle could not be read: %s", err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("the CA bundle '%s' has no PEM certificates", f)
+		}
+	}
+	return pool, nil
+}
+
+func isTimeout(err error) bool {
+	if uErr, ok := err.(*url.Error); ok {
+		err = uErr.Err
+	}
+	nErr, ok := err.(net.Error)
+	return ok && nErr.Timeout()
+}
@@ -0,0 +1,267 @@
+package agentclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListDeployments(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "admin", user)
+		assert.Equal(t, "pass", pass)
+		assert.Equal(t, "GET", r.Method)
+		fmt.Fprint(w, `[{"id":1,"name":"Wordpress"}]`)
+	}))
+	defer s.Close()
+
+	c := Client{Endpoint: s.URL, Username: "admin", Password: "pass"}
+	deployments, err := c.ListDeployments()
+	assert.NoError(t, err)
+	assert.Equal(t, []agent.DeploymentResponseLite{{ID: 1, Name: "Wordpress"}}, deployments)
+}
+
+func TestErroredRequest(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "not found")
+	}))
+	defer s.Close()
+
+	c := Client{Endpoint: s.URL}
+	err := c.DeleteDeployment("1")
+	assert.Equal(t, client.RequestError{StatusCode: 404, Body: "not found"}, err)
+}
+
+func TestTimeouts(t *testing.T) {
+	c := Client{}
+	assert.Equal(t, 10*time.Second, c.timeout("GET"))
+	assert.Equal(t, 2*time.Minute, c.timeout("DELETE"))
+
+	c.Timeouts = Timeouts{Mutate: 5 * time.Minute}
+	assert.Equal(t, 10*time.Second, c.timeout("GET"))
+	assert.Equal(t, 5*time.Minute, c.timeout("POST"))
+}
+
+func TestErroredTimeout(t *testing.T) {
+	done := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer s.Close()
+	defer close(done)
+
+	c := Client{
+		Endpoint: s.URL,
+		Timeouts: Timeouts{Read: 10 * time.Millisecond, Mutate: 10 * time.Millisecond},
+		Retry:    RetryPolicy{MaxAttempts: 1},
+	}
+	_, err := c.GetMetadata()
+	assert.EqualError(t, err, fmt.Sprintf("the agent didn't respond to GET %s/metadata within 10ms", s.URL))
+
+	_, err = c.RedeployDeployment("1")
+	if assert.IsType(t, TimeoutError{}, err) {
+		assert.Contains(t, err.Error(), "so it may or may not have happened")
+	}
+}
+
+func TestProxiedRequest(t *testing.T) {
+	var proxied string
+	p := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		fmt.Fprint(w, `[]`)
+	}))
+	defer p.Close()
+
+	c := Client{Endpoint: "http://agent.example.com:3001", Proxy: p.URL}
+	_, err := c.ListDeployments()
+	assert.NoError(t, err)
+	assert.Equal(t, "http://agent.example.com:3001/deployments", proxied)
+}
+
+func TestProxyFor(t *testing.T) {
+	c := Client{Proxy: "http://proxy.example.com:3128"}
+	u, err := c.ProxyFor("https://agent.example.com:3001")
+	assert.NoError(t, err)
+	assert.Equal(t, "proxy.example.com:3128", u.Host)
+
+	c.Proxy = Direct
+	u, err = c.ProxyFor("https://agent.example.com:3001")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+
+	c.Proxy = "proxy.example.com"
+	_, err = c.ProxyFor("https://agent.example.com:3001")
+	assert.EqualError(t, err, "'proxy.example.com' is not a proxy URL, use e.g. 'http://proxy.example.com:3128'")
+}
+
+func TestCABundle(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	defer s.Close()
+
+	c := Client{Endpoint: s.URL, Retry: RetryPolicy{MaxAttempts: 1}}
+	_, err := c.ListDeployments()
+	assert.Error(t, err)
+
+	f, err := ioutil.TempFile("", "pmx-ca")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	f.Close()
+
+	c = Client{Endpoint: s.URL, CAFiles: []string{f.Name()}}
+	_, err = c.ListDeployments()
+	assert.NoError(t, err)
+}
+
+func TestErroredCABundle(t *testing.T) {
+	c := Client{Endpoint: "https://agent.example.com:3001", CAFiles: []string{"/nonexistant.pem"}}
+	_, err := c.ListDeployments()
+	assert.EqualError(t, err, "the CA bundle could not be read: open /nonexistant.pem: no such file or directory")
+}
+
+// writeClientCertificate writes a self-signed certificate and its key to
+// temporary files, returning their paths.
+func writeClientCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pmxcli"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile, err := ioutil.TempFile("", "pmx-client-cert")
+	assert.NoError(t, err)
+	pem.Encode(certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	certFile.Close()
+	keyFile, err := ioutil.TempFile("", "pmx-client-key")
+	assert.NoError(t, err)
+	pem.Encode(keyFile, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	keyFile.Close()
+	return certFile.Name(), keyFile.Name()
+}
+
+func TestClientCertificate(t *testing.T) {
+	certFile, keyFile := writeClientCertificate(t)
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+	var presented []string
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range r.TLS.PeerCertificates {
+			presented = append(presented, c.Subject.CommonName)
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	s.StartTLS()
+	defer s.Close()
+	client.SkipSSLVerify = true
+	defer func() { client.SkipSSLVerify = false }()
+
+	c := Client{Endpoint: s.URL, Retry: RetryPolicy{MaxAttempts: 1}}
+	_, err := c.ListDeployments()
+	assert.Error(t, err)
+
+	c = Client{Endpoint: s.URL, ClientCert: certFile, ClientKey: keyFile}
+	_, err = c.ListDeployments()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"pmxcli"}, presented)
+}
+
+func TestErroredClientCertificate(t *testing.T) {
+	certFile, keyFile := writeClientCertificate(t)
+	defer os.Remove(certFile)
+	defer os.Remove(keyFile)
+
+	_, err := ClientCertificate(certFile, "")
+	assert.EqualError(t, err, "a client certificate needs both a certificate and a key file")
+	_, err = ClientCertificate(keyFile, certFile)
+	assert.Contains(t, err.Error(), "the client certificate could not be loaded: ")
+}
+
+func TestReusedConnections(t *testing.T) {
+	connections := 0
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections++
+		}
+	}
+	s.StartTLS()
+	defer s.Close()
+
+	f, err := ioutil.TempFile("", "pmx-ca")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+	f.Close()
+
+	c := Client{Endpoint: s.URL, CAFiles: []string{f.Name()}}
+	for i := 0; i < 3; i++ {
+		_, err := c.ListDeployments()
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, c.DeleteDeployment("1"))
+	assert.Equal(t, 1, connections)
+}
+
+type recordingTransport struct {
+	Requests []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.Requests = append(t.Requests, req.Method+" "+req.URL.String())
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`[{"id":1}]`)),
+		Request:    req,
+	}, nil
+}
+
+func TestWrapTransport(t *testing.T) {
+	var wrapped http.RoundTripper
+	rt := &recordingTransport{}
+	c := Client{
+		Endpoint: "https://agent.example.com:3001",
+		WrapTransport: func(base http.RoundTripper) http.RoundTripper {
+			wrapped = base
+			return rt
+		},
+	}
+
+	deployments, err := c.ListDeployments()
+	assert.NoError(t, err)
+	assert.Equal(t, []agent.DeploymentResponseLite{{ID: 1}}, deployments)
+	assert.Equal(t, []string{"GET https://agent.example.com:3001/deployments"}, rt.Requests)
+	assert.IsType(t, &http.Transport{}, wrapped)
+}
@@ -0,0 +1,104 @@
+package agentclient
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"time"
+)
+
+// A RetryPolicy decides how often a failed call to the agent is tried again.
+// Calls that only read are retried after connection errors and when a proxy
+// or the agent reports that it's unavailable, waiting twice as long, with
+// some jitter, after each attempt. Calls that change things are only retried
+// when the request never reached the agent, because otherwise the change may
+// have happened already.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, so 1 turns retries off.
+	MaxAttempts int
+	// Backoff is how long to wait before the first retry.
+	Backoff time.Duration
+	// MaxBackoff limits how long to wait before any retry.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used for clients without their own policy.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// sleep is replaced in tests so that retries don't slow them down.
+var sleep = time.Sleep
+
+func (p RetryPolicy) String() string {
+	if p.MaxAttempts <= 1 {
+		return "no retries"
+	}
+	return fmt.Sprintf("up to %d attempts, backing off from %s to at most %s", p.MaxAttempts, p.Backoff, p.MaxBackoff)
+}
+
+// delay is how long to wait after the given attempt: the backoff doubled for
+// each earlier attempt, then reduced by up to half at random so that many
+// clients don't retry in step.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// retryReason explains why a call that got the status or error should be
+// tried again, or is empty when it shouldn't be.
+func retryReason(method string, status int, err error) string {
+	if err != nil {
+		if neverSent(err) {
+			return fmt.Sprintf("the request never reached the agent: %s", err)
+		}
+		if isIdempotent(method) && isConnectionError(err) {
+			return fmt.Sprintf("the connection failed: %s", err)
+		}
+		return ""
+	}
+
+	switch status {
+	case 502, 503, 504:
+		if isIdempotent(method) {
+			return fmt.Sprintf("the agent responded %d", status)
+		}
+	}
+	return ""
+}
+
+func isIdempotent(method string) bool {
+	return method == "GET"
+}
+
+// neverSent is true for errors from connecting to the agent, before any of
+// the request could be sent.
+func neverSent(err error) bool {
+	if uErr, ok := err.(*url.Error); ok {
+		err = uErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// isConnectionError is true for network failures, but not for problems like
+// an untrusted certificate that will happen again on every attempt.
+func isConnectionError(err error) bool {
+	if uErr, ok := err.(*url.Error); ok {
+		err = uErr.Err
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
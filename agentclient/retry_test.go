@@ -0,0 +1,120 @@
+package agentclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSleep() *[]time.Duration {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	return &slept
+}
+
+func TestRetriedRead(t *testing.T) {
+	slept := setupSleep()
+	defer func() { sleep = time.Sleep }()
+	attempts := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"agent":{"version":"0.1"}}`)
+	}))
+	defer s.Close()
+
+	c := Client{Endpoint: s.URL}
+	m, err := c.GetMetadata()
+	assert.NoError(t, err)
+	assert.Equal(t, "0.1", m.Agent.Version)
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, *slept, 2)
+}
+
+func TestErroredRetriedRead(t *testing.T) {
+	setupSleep()
+	defer func() { sleep = time.Sleep }()
+	attempts := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer s.Close()
+
+	c := Client{Endpoint: s.URL, Retry: RetryPolicy{MaxAttempts: 2}}
+	_, err := c.ListDeployments()
+	assert.Equal(t, client.RequestError{StatusCode: 502, Body: ""}, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestUnretriedCalls(t *testing.T) {
+	slept := setupSleep()
+	defer func() { sleep = time.Sleep }()
+	status := http.StatusNotFound
+	attempts := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+
+	c := Client{Endpoint: s.URL}
+	_, err := c.DescribeDeployment("1")
+	assert.Equal(t, client.RequestError{StatusCode: 404, Body: ""}, err)
+
+	status = http.StatusServiceUnavailable
+	err = c.DeleteDeployment("1")
+	assert.Equal(t, client.RequestError{StatusCode: 503, Body: ""}, err)
+	assert.Equal(t, 2, attempts)
+	assert.Empty(t, *slept)
+}
+
+func TestRetriedUnsentMutation(t *testing.T) {
+	slept := setupSleep()
+	defer func() { sleep = time.Sleep }()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	endpoint := "http://" + l.Addr().String()
+	l.Close()
+
+	c := Client{Endpoint: endpoint}
+	_, err = c.RedeployDeployment("1")
+	assert.Error(t, err)
+	assert.Len(t, *slept, 2)
+}
+
+func TestRetryReason(t *testing.T) {
+	dialErr := &url.Error{Op: "Post", URL: "http://example.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}
+	readErr := &url.Error{Op: "Get", URL: "http://example.com", Err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}}
+
+	assert.Contains(t, retryReason("POST", 0, dialErr), "the request never reached the agent")
+	assert.Contains(t, retryReason("GET", 0, readErr), "the connection failed")
+	assert.Empty(t, retryReason("POST", 0, readErr))
+	assert.Empty(t, retryReason("GET", 0, &url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("x509: certificate signed by unknown authority")}))
+	assert.Equal(t, "the agent responded 504", retryReason("GET", 504, nil))
+	assert.Empty(t, retryReason("GET", 500, nil))
+	assert.Empty(t, retryReason("GET", 429, nil))
+	assert.Empty(t, retryReason("DELETE", 503, nil))
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, Backoff: time.Second, MaxBackoff: 3 * time.Second}
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		d := p.delay(attempt + 1)
+		assert.True(t, d >= max/2 && d <= max, "attempt %d waited %s", attempt+1, d)
+	}
+
+	assert.Equal(t, "up to 5 attempts, backing off from 1s to at most 3s", p.String())
+	assert.Equal(t, "no retries", RetryPolicy{MaxAttempts: 1}.String())
+}
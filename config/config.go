@@ -12,11 +12,17 @@ import (
 
 type Config interface {
 	Save(name string, token string) error
+	Update(r Remote) error
 	Remove(name string) error
 	Get(name string) (Remote, error)
 	Remotes() []Remote
 	SetActive(name string) error
 	Active() *Remote
+	TemplateRepos() []string
+	AddTemplateRepo(path string) error
+	RemoveTemplateRepo(path string) error
+	SecretStore() *SecretStore
+	SetSecretStore(s SecretStore) error
 }
 
 type FileConfig struct {
@@ -27,6 +33,25 @@ type FileConfig struct {
 type Store struct {
 	Active  string   `json:"active"`
 	Remotes []Remote `json:"remotes"`
+	// TemplateRepos are the directories that make up the template catalog.
+	TemplateRepos []string `json:"template_repos,omitempty"`
+	// Secrets is where the secret:// references in templates are resolved.
+	Secrets *SecretStore `json:"secrets,omitempty"`
+}
+
+// The backends that a SecretStore can use.
+const (
+	SecretBackendDir  = "dir"
+	SecretBackendFile = "file"
+	SecretBackendExec = "exec"
+)
+
+// A SecretStore is a local store of secrets: a directory with a file per
+// secret, an encrypted file, or a helper command that looks them up.
+type SecretStore struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path,omitempty"`
+	Command string `json:"command,omitempty"`
 }
 
 type Remote struct {
@@ -36,6 +61,19 @@ type Remote struct {
 	Username   string `json:"username"`
 	Password   string `json:"password"`
 	PrivateKey string `json:"private_key"`
+	Labels     Labels `json:"labels,omitempty"`
+	// Timeouts is nil for remotes that use the default timeouts.
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+	// Proxy is the URL of a proxy to reach the agent through, or "direct" to
+	// ignore the proxy environment variables.
+	Proxy string `json:"proxy,omitempty"`
+	// CABundle is a PEM file of certificates to trust besides the one in the
+	// token.
+	CABundle string `json:"ca_bundle,omitempty"`
+	// ClientCert and ClientKey are PEM files of a certificate and key to
+	// present, for agents behind proxies that require client certificates.
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
 }
 
 func (c *FileConfig) Save(name string, token string) error {
@@ -48,6 +86,16 @@ func (c *FileConfig) Save(name string, token string) error {
 	return c.saveAll()
 }
 
+func (c *FileConfig) Update(r Remote) error {
+	for i, existing := range c.store.Remotes {
+		if existing.Name == r.Name {
+			c.store.Remotes[i] = r
+			return c.saveAll()
+		}
+	}
+	return fmt.Errorf("remote '%s' does not exist", r.Name)
+}
+
 func (c *FileConfig) Remove(name string) error {
 	if _, err := c.Get(name); err != nil {
 		return err
@@ -101,6 +149,58 @@ func (c *FileConfig) Active() *Remote {
 	return nil
 }
 
+func (c *FileConfig) TemplateRepos() []string {
+	return c.store.TemplateRepos
+}
+
+func (c *FileConfig) AddTemplateRepo(path string) error {
+	for _, p := range c.store.TemplateRepos {
+		if p == path {
+			return fmt.Errorf("'%s' is already a template repo", path)
+		}
+	}
+
+	c.store.TemplateRepos = append(c.store.TemplateRepos, path)
+	return c.saveAll()
+}
+
+func (c *FileConfig) RemoveTemplateRepo(path string) error {
+	var repos []string
+	for _, p := range c.store.TemplateRepos {
+		if p != path {
+			repos = append(repos, p)
+		}
+	}
+	if len(repos) == len(c.store.TemplateRepos) {
+		return fmt.Errorf("'%s' is not a template repo", path)
+	}
+
+	c.store.TemplateRepos = repos
+	return c.saveAll()
+}
+
+func (c *FileConfig) SecretStore() *SecretStore {
+	return c.store.Secrets
+}
+
+func (c *FileConfig) SetSecretStore(s SecretStore) error {
+	switch s.Backend {
+	case SecretBackendDir, SecretBackendFile:
+		if s.Path == "" {
+			return fmt.Errorf("the %s secret backend needs a path", s.Backend)
+		}
+	case SecretBackendExec:
+		if s.Command == "" {
+			return errors.New("the exec secret backend needs a command")
+		}
+	default:
+		return fmt.Errorf("unknown secret backend '%s', use dir, file or exec", s.Backend)
+	}
+
+	c.store.Secrets = &s
+	return c.saveAll()
+}
+
 func (c *FileConfig) Load() error {
 	f, err := os.Open(c.Path)
 	if err != nil {
@@ -115,6 +115,67 @@ func TestSuccessfulActiveRemove(t *testing.T) {
 	assert.Nil(t, c.Active())
 }
 
+func TestConfigUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-test")
+	defer os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	c := FileConfig{
+		Path:  dir + "/agent",
+		store: Store{Remotes: []Remote{{Name: "Test"}, {Name: "Other"}}},
+	}
+	err = c.Update(Remote{Name: "Test", Labels: Labels{"env": "prod"}})
+	assert.NoError(t, err)
+
+	// To make sure it really got persisted...
+	c.store = Store{}
+	assert.NoError(t, c.Load())
+	if assert.Len(t, c.Remotes(), 2) {
+		assert.Equal(t, Labels{"env": "prod"}, c.Remotes()[0].Labels)
+		assert.Empty(t, c.Remotes()[1].Labels)
+	}
+}
+
+func TestConfigTemplateRepos(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-test")
+	defer os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	c := FileConfig{Path: dir + "/agent"}
+	assert.NoError(t, c.AddTemplateRepo("/templates"))
+	assert.NoError(t, c.AddTemplateRepo("/other"))
+	assert.EqualError(t, c.AddTemplateRepo("/other"), "'/other' is already a template repo")
+	assert.NoError(t, c.RemoveTemplateRepo("/templates"))
+	assert.EqualError(t, c.RemoveTemplateRepo("/templates"), "'/templates' is not a template repo")
+
+	c.store = Store{}
+	assert.NoError(t, c.Load())
+	assert.Equal(t, []string{"/other"}, c.TemplateRepos())
+}
+
+func TestConfigSecretStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-test")
+	defer os.RemoveAll(dir)
+	assert.NoError(t, err)
+
+	c := FileConfig{Path: dir + "/agent"}
+	assert.Nil(t, c.SecretStore())
+	assert.NoError(t, c.SetSecretStore(SecretStore{Backend: SecretBackendDir, Path: "/secrets"}))
+	assert.EqualError(t, c.SetSecretStore(SecretStore{Backend: SecretBackendFile}), "the file secret backend needs a path")
+	assert.EqualError(t, c.SetSecretStore(SecretStore{Backend: SecretBackendExec}), "the exec secret backend needs a command")
+	assert.EqualError(t, c.SetSecretStore(SecretStore{Backend: "vault"}), "unknown secret backend 'vault', use dir, file or exec")
+
+	c.store = Store{}
+	assert.NoError(t, c.Load())
+	assert.Equal(t, &SecretStore{Backend: SecretBackendDir, Path: "/secrets"}, c.SecretStore())
+}
+
+func TestErroredNonexistantUpdate(t *testing.T) {
+	c := FileConfig{}
+	err := c.Update(Remote{Name: "Nonexistant"})
+	assert.EqualError(t, err, "remote 'Nonexistant' does not exist")
+}
+
 func TestErroredNonexistantRemove(t *testing.T) {
 	c := FileConfig{}
 	err := c.Remove("Nonexistant")
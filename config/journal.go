@@ -0,0 +1,132 @@
+package config
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A Journal is a local record of the deployments made with the CLI. The agent
+// doesn't remember which template a deployment was created from, so this is
+// the only place that information is kept.
+type Journal interface {
+	Record(e JournalEntry, template []byte, override []byte) error
+	Entries() ([]JournalEntry, error)
+	Template(hash string) ([]byte, error)
+}
+
+// A JournalEntry describes a single change made to a deployment on a remote.
+type JournalEntry struct {
+	Time         time.Time `json:"time"`
+	User         string    `json:"user,omitempty"`
+	Action       string    `json:"action"`
+	Remote       string    `json:"remote"`
+	DeploymentID int       `json:"deployment_id"`
+	// PreviousID is the ID of the deployment that a redeployment replaced.
+	PreviousID   int    `json:"previous_id,omitempty"`
+	Name         string `json:"name"`
+	TemplatePath string `json:"template_path,omitempty"`
+	TemplateHash string `json:"template_hash,omitempty"`
+	OverridePath string `json:"override_path,omitempty"`
+	OverrideHash string `json:"override_hash,omitempty"`
+}
+
+// FileJournal appends entries to the file at Path, one JSON object per line,
+// and stores the content of each template and override in TemplateDir named
+// after its SHA-256 hash so that identical templates are only stored once.
+type FileJournal struct {
+	Path        string
+	TemplateDir string
+}
+
+// Record appends the entry to the journal. When template or override are
+// given, their content is stored and the entry's hashes are set to match.
+func (j *FileJournal) Record(e JournalEntry, template []byte, override []byte) error {
+	if template != nil {
+		hash, err := j.saveTemplate(template)
+		if err != nil {
+			return err
+		}
+		e.TemplateHash = hash
+	}
+	if override != nil {
+		hash, err := j.saveTemplate(override)
+		if err != nil {
+			return err
+		}
+		e.OverrideHash = hash
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+func (j *FileJournal) Entries() ([]JournalEntry, error) {
+	f, err := os.Open(j.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+
+		var e JournalEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("Error parsing journal line %d: %s", line, err.Error())
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, s.Err()
+}
+
+// Template returns the stored content of the template or override with the
+// given hash.
+func (j *FileJournal) Template(hash string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(j.TemplateDir, hash+".pmx"))
+}
+
+// TemplateHash returns the hash that journal entries use to identify the
+// content of a template.
+func TemplateHash(template []byte) string {
+	sum := sha256.Sum256(template)
+	return hex.EncodeToString(sum[:])
+}
+
+func (j *FileJournal) saveTemplate(template []byte) (string, error) {
+	hash := TemplateHash(template)
+
+	if err := os.MkdirAll(j.TemplateDir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(j.TemplateDir, hash+".pmx")
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	return hash, ioutil.WriteFile(path, template, 0600)
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupJournal(t *testing.T) (FileJournal, string) {
+	dir, err := ioutil.TempDir("", "journal-test")
+	assert.NoError(t, err)
+	return FileJournal{Path: dir + "/journal", TemplateDir: dir + "/templates"}, dir
+}
+
+func TestJournalPersistence(t *testing.T) {
+	j, dir := setupJournal(t)
+	defer os.RemoveAll(dir)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	e := JournalEntry{
+		Time:         now,
+		Action:       "create",
+		Remote:       "Test",
+		DeploymentID: 1,
+		Name:         "Wordpress",
+		TemplatePath: "wordpress.pmx",
+	}
+	assert.NoError(t, j.Record(e, []byte("name: Wordpress"), nil))
+	e.DeploymentID = 2
+	e.OverridePath = "prod.pmx"
+	assert.NoError(t, j.Record(e, []byte("name: Wordpress"), []byte("images: []")))
+
+	entries, err := j.Entries()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, now, entries[0].Time)
+		assert.Equal(t, "create", entries[0].Action)
+		assert.Equal(t, "Test", entries[0].Remote)
+		assert.Equal(t, 1, entries[0].DeploymentID)
+		assert.Equal(t, "wordpress.pmx", entries[0].TemplatePath)
+		assert.Len(t, entries[0].TemplateHash, 64)
+		assert.Empty(t, entries[0].OverrideHash)
+		assert.Equal(t, 2, entries[1].DeploymentID)
+		assert.Equal(t, entries[0].TemplateHash, entries[1].TemplateHash)
+		assert.Equal(t, "prod.pmx", entries[1].OverridePath)
+		assert.Equal(t, TemplateHash([]byte("images: []")), entries[1].OverrideHash)
+
+		b, err := j.Template(entries[0].TemplateHash)
+		assert.NoError(t, err)
+		assert.Equal(t, "name: Wordpress", string(b))
+		b, err = j.Template(entries[1].OverrideHash)
+		assert.NoError(t, err)
+		assert.Equal(t, "images: []", string(b))
+	}
+
+	files, err := ioutil.ReadDir(j.TemplateDir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	info, err := os.Stat(j.Path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestJournalWithoutTemplate(t *testing.T) {
+	j, dir := setupJournal(t)
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, j.Record(JournalEntry{Action: "delete"}, nil, nil))
+	assert.NoError(t, j.Record(JournalEntry{Action: "redeploy", TemplateHash: "abc"}, nil, nil))
+	entries, err := j.Entries()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Empty(t, entries[0].TemplateHash)
+		assert.Equal(t, "abc", entries[1].TemplateHash)
+	}
+}
+
+func TestSuccessfulNonExistantJournalEntries(t *testing.T) {
+	j := FileJournal{Path: "/nonexistant/journal"}
+	entries, err := j.Entries()
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestErroredBadFormatJournalEntries(t *testing.T) {
+	j, dir := setupJournal(t)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(j.Path, []byte("{}\nBAD\n"), 0600))
+
+	_, err := j.Entries()
+	assert.Contains(t, err.Error(), "Error parsing journal line 2")
+}
+
+func TestErroredMissingJournalTemplate(t *testing.T) {
+	j, dir := setupJournal(t)
+	defer os.RemoveAll(dir)
+
+	_, err := j.Template("missing")
+	assert.Contains(t, err.Error(), "no such file")
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var labelFormat = regexp.MustCompile(`^[a-zA-Z0-9_./-]+$`)
+
+// Labels are free-form key/value pairs attached to a remote, like "env=prod",
+// that can be used to select groups of remotes.
+type Labels map[string]string
+
+// ParseLabels parses a comma-separated list of key=value pairs, as used for
+// both labelling remotes and selecting them.
+func ParseLabels(s string) (Labels, error) {
+	labels := Labels{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !labelFormat.MatchString(kv[0]) || !labelFormat.MatchString(kv[1]) {
+			return nil, fmt.Errorf("invalid label '%s', labels must look like key=value", pair)
+		}
+		labels[kv[0]] = kv[1]
+	}
+
+	return labels, nil
+}
+
+// Matches is true when the labels include every key/value pair in the
+// selector. An empty selector matches everything.
+func (l Labels) Matches(selector Labels) bool {
+	for k, v := range selector {
+		if l[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the labels as a comma-separated list of key=value pairs,
+// sorted by key.
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// SelectRemotes returns the remotes whose labels match the selector.
+func SelectRemotes(remotes []Remote, selector Labels) []Remote {
+	var selected []Remote
+	for _, r := range remotes {
+		if r.Labels.Matches(selector) {
+			selected = append(selected, r)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabels(t *testing.T) {
+	l, err := ParseLabels("env=prod, region=us-east,team=web")
+	assert.NoError(t, err)
+	assert.Equal(t, Labels{"env": "prod", "region": "us-east", "team": "web"}, l)
+
+	l, err = ParseLabels("")
+	assert.NoError(t, err)
+	assert.Empty(t, l)
+}
+
+func TestErroredParseLabels(t *testing.T) {
+	_, err := ParseLabels("env")
+	assert.EqualError(t, err, "invalid label 'env', labels must look like key=value")
+
+	_, err = ParseLabels("env=")
+	assert.Error(t, err)
+
+	_, err = ParseLabels("env=prod,bad key=value")
+	assert.EqualError(t, err, "invalid label 'bad key=value', labels must look like key=value")
+}
+
+func TestLabelsMatches(t *testing.T) {
+	l := Labels{"env": "prod", "region": "us-east"}
+	assert.True(t, l.Matches(Labels{}))
+	assert.True(t, l.Matches(Labels{"env": "prod"}))
+	assert.True(t, l.Matches(Labels{"env": "prod", "region": "us-east"}))
+	assert.False(t, l.Matches(Labels{"env": "staging"}))
+	assert.False(t, l.Matches(Labels{"team": "web"}))
+	assert.False(t, Labels(nil).Matches(Labels{"env": "prod"}))
+}
+
+func TestLabelsString(t *testing.T) {
+	assert.Equal(t, "env=prod,region=us-east", Labels{"region": "us-east", "env": "prod"}.String())
+	assert.Equal(t, "", Labels(nil).String())
+}
+
+func TestSelectRemotes(t *testing.T) {
+	remotes := []Remote{
+		{Name: "A", Labels: Labels{"env": "prod"}},
+		{Name: "B", Labels: Labels{"env": "staging"}},
+		{Name: "C"},
+	}
+
+	selected := SelectRemotes(remotes, Labels{"env": "prod"})
+	if assert.Len(t, selected, 1) {
+		assert.Equal(t, "A", selected[0].Name)
+	}
+	assert.Len(t, SelectRemotes(remotes, Labels{}), 3)
+}
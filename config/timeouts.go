@@ -0,0 +1,39 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration is a time.Duration that is stored as a string like "30s" or "5m",
+// so the config file stays readable and can be edited by hand.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Timeouts override how long calls to a remote's agent may take. Reads list
+// and describe deployments; mutations create, redeploy and delete them. A
+// zero timeout uses the default.
+type Timeouts struct {
+	Read   Duration `json:"read,omitempty"`
+	Mutate Duration `json:"mutate,omitempty"`
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutsJSON(t *testing.T) {
+	b, err := json.Marshal(Timeouts{Mutate: Duration(5 * time.Minute)})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"mutate":"5m0s"}`, string(b))
+
+	var ts Timeouts
+	assert.NoError(t, json.Unmarshal([]byte(`{"read":"30s","mutate":"10m"}`), &ts))
+	assert.Equal(t, Timeouts{Read: Duration(30 * time.Second), Mutate: Duration(10 * time.Minute)}, ts)
+}
+
+func TestErroredTimeoutsJSON(t *testing.T) {
+	var ts Timeouts
+	assert.EqualError(t, json.Unmarshal([]byte(`{"read":"soon"}`), &ts), "time: invalid duration \"soon\"")
+}
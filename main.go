@@ -4,14 +4,19 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/CenturyLinkLabs/panamax-remote-agent-go/client"
 	"github.com/CenturyLinkLabs/panamaxcli/actions"
+	"github.com/CenturyLinkLabs/panamaxcli/agentclient"
 	"github.com/CenturyLinkLabs/panamaxcli/config"
+	"github.com/CenturyLinkLabs/panamaxcli/redact"
+	"github.com/CenturyLinkLabs/prettycli"
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 )
@@ -29,11 +34,14 @@ If you're positive that this is not an issue, you can rerun your command with th
 var (
 	Config   config.Config
 	Commands []cli.Command
+
+	selectorFlag = cli.StringFlag{
+		Name:  "selector",
+		Usage: "Only use remotes with all of these labels, e.g. 'env=prod,region=us-east'",
+	}
 )
 
 func init() {
-	client.DefaultHTTPTimeout = 10
-
 	Commands = []cli.Command{
 		{
 			Name:    "remote",
@@ -45,6 +53,20 @@ func init() {
 					Aliases: []string{"l"},
 					Usage:   "List remotes",
 					Action:  remoteListAction,
+					Flags:   []cli.Flag{selectorFlag},
+				},
+				{
+					Name:   "status",
+					Usage:  "Show the status of every remote",
+					Action: remoteStatusAction,
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:  "timeout",
+							Value: 5 * time.Second,
+							Usage: "How long to wait for each remote before reporting it as unreachable",
+						},
+						selectorFlag,
+					},
 				},
 				{
 					Name:        "describe",
@@ -57,9 +79,19 @@ func init() {
 				{
 					Name:        "add",
 					Usage:       "Add a remote",
-					Description: "Arguments are the name of the remote and the path to the token file.",
+					Description: "Arguments are the name of the remote and the path to the token file. Flags must come before them.",
 					Before:      actionRequiresArgument("remote name", "token path"),
 					Action:      remoteAddAction,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "client-cert",
+							Usage: "A PEM certificate to present to the remote, for agents behind proxies that require client certificates",
+						},
+						cli.StringFlag{
+							Name:  "client-key",
+							Usage: "The PEM key for --client-cert",
+						},
+					},
 				},
 				{
 					Name:        "active",
@@ -75,13 +107,312 @@ func init() {
 					Before:      actionRequiresArgument("remote name"),
 					Action:      removeRemoteAction,
 				},
+				{
+					Name:        "label",
+					Usage:       "Add labels to a remote",
+					Description: "Arguments are the name of the remote and comma-separated labels, e.g. 'env=prod,region=us-east'.",
+					Before:      actionRequiresArgument("remote name", "labels"),
+					Action:      labelRemoteAction,
+				},
+				{
+					Name:        "unlabel",
+					Usage:       "Remove labels from a remote",
+					Description: "Arguments are the name of the remote and comma-separated label keys, e.g. 'env,region'.",
+					Before:      actionRequiresArgument("remote name", "label keys"),
+					Action:      unlabelRemoteAction,
+				},
+				{
+					Name:        "timeout",
+					Usage:       "Set how long calls to a remote may take",
+					Description: "Argument is the name of the remote. Reads default to 10s and changes, like deploying, to 2m. Flags must come before the argument.",
+					Before:      actionRequiresArgument("remote name"),
+					Action:      remoteTimeoutAction,
+					Flags: []cli.Flag{
+						cli.DurationFlag{
+							Name:  "read",
+							Usage: "How long to wait when listing and describing deployments, e.g. '30s'",
+						},
+						cli.DurationFlag{
+							Name:  "mutate",
+							Usage: "How long to wait when creating, redeploying and deleting deployments, e.g. '10m'",
+						},
+						cli.BoolFlag{
+							Name:  "reset",
+							Usage: "Go back to the default timeouts",
+						},
+					},
+				},
+				{
+					Name:        "proxy",
+					Usage:       "Set the proxy to reach a remote through",
+					Description: "Arguments are the name of the remote and optionally a proxy URL, e.g. 'http://proxy.example.com:3128', or 'direct' to ignore the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables. When omitted, those variables are used.",
+					Before:      actionRequiresArgument("remote name", "optional:proxy URL"),
+					Action:      remoteProxyAction,
+				},
+				{
+					Name:        "ca-bundle",
+					Usage:       "Trust more certificates for a remote",
+					Description: "Arguments are the name of the remote and optionally a PEM file of certificates, e.g. from an internal CA, to trust besides the one in the token. When omitted, only the token's certificate is trusted.",
+					Before:      actionRequiresArgument("remote name", "optional:PEM file"),
+					Action:      remoteCABundleAction,
+				},
+				{
+					Name:        "client-cert",
+					Usage:       "Set the client certificate a remote presents",
+					Description: "Arguments are the name of the remote and optionally the PEM files of a certificate and its key, for agents behind proxies that require client certificates. When omitted, no client certificate is presented.",
+					Before:      actionRequiresArgument("remote name", "optional:certificate file", "optional:key file"),
+					Action:      remoteClientCertAction,
+				},
 				{
 					Name:        "token",
 					Usage:       "Show the remote's token",
-					Description: "Argument is a remote name.",
+					Description: "Argument is optionally the name of the remote. The token holds the agent's password and certificate, so only a fingerprint of it is shown unless one of the flags is given. Flags must come before the argument.",
 					Before:      actionRequiresArgument("optional:remote name"),
 					Action:      getTokenAction,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "reveal",
+							Usage: "Print the token itself",
+						},
+						cli.StringFlag{
+							Name:  "copy",
+							Usage: "Write the token to this file, readable only by you",
+						},
+						cli.BoolFlag{
+							Name:  "qr",
+							Usage: "Print the token as a QR code to scan on another workstation",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "apply",
+			Usage:  "Reconcile remotes with a manifest of desired deployments",
+			Action: applyAction,
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file, f",
+					Usage: "Path to the manifest",
+				},
+				cli.BoolFlag{
+					Name:  "prune",
+					Usage: "Delete deployments that aren't in the manifest",
+				},
+				cli.BoolFlag{
+					Name:  "yes",
+					Usage: "Carry out the plan instead of only displaying it",
+				},
+			},
+		},
+		{
+			Name:  "secret",
+			Usage: "Manage the local store of secrets that templates refer to as 'secret://NAME'",
+			Subcommands: []cli.Command{
+				{
+					Name:        "store",
+					Usage:       "Set where secrets are read from",
+					Description: "Arguments are the backend, and its path or command. The dir backend reads a file per secret from a directory, the file backend reads an encrypted file using the passphrase in PMX_SECRETS_PASSPHRASE, and the exec backend runs a helper command with the secret's name as its last argument.",
+					Before:      actionRequiresArgument("dir, file or exec", "path or command"),
+					Action:      secretStoreAction,
+				},
+				{
+					Name:        "set",
+					Usage:       "Add or change a secret",
+					Description: "Argument is the secret's name, such as 'db/password'. The value is read from standard input, e.g. 'pmxcli secret set db/password < password.txt'.",
+					Before:      actionRequiresArgument("secret name"),
+					Action:      secretSetAction,
+				},
+				{
+					Name:   "list",
+					Usage:  "List the names of the secrets",
+					Action: secretListAction,
+				},
+				{
+					Name:        "remove",
+					Usage:       "Remove a secret",
+					Description: "Argument is the secret's name.",
+					Before:      actionRequiresArgument("secret name"),
+					Action:      secretRemoveAction,
+				},
+			},
+		},
+		{
+			Name:    "template",
+			Aliases: []string{"te"},
+			Usage:   "Work with templates",
+			Subcommands: []cli.Command{
+				{
+					Name:  "repo",
+					Usage: "Manage the directories of templates in the catalog",
+					Subcommands: []cli.Command{
+						{
+							Name:        "add",
+							Usage:       "Add a directory of templates to the catalog",
+							Description: "Argument is the path to a directory, such as a Git checkout of a template repository.",
+							Before:      actionRequiresArgument("directory"),
+							Action:      templateRepoAddAction,
+						},
+						{
+							Name:   "list",
+							Usage:  "List the directories in the catalog",
+							Action: templateRepoListAction,
+						},
+						{
+							Name:        "remove",
+							Usage:       "Remove a directory from the catalog",
+							Description: "Argument is the path to the directory.",
+							Before:      actionRequiresArgument("directory"),
+							Action:      templateRepoRemoveAction,
+						},
+					},
+				},
+				{
+					Name:        "search",
+					Usage:       "Search the catalog for templates",
+					Description: "Argument is a keyword matched against each template's name, description, keywords and type.",
+					Before:      actionRequiresArgument("keyword"),
+					Action:      templateSearchAction,
+				},
+				{
+					Name:        "show",
+					Usage:       "Describe a template in the catalog",
+					Description: "Argument is the template's name.",
+					Before:      actionRequiresArgument("template name"),
+					Action:      templateShowAction,
+				},
+				{
+					Name:        "new",
+					Usage:       "Write a skeleton template to fill in",
+					Description: "Argument is the template's name. Values for ports, environment, links and volumes start with the name of their image, as in 'wp=8080:80', unless there is only one image. Flags must come before the argument.",
+					Before:      actionRequiresArgument("template name"),
+					Action:      templateNewAction,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "interactive, i",
+							Usage: "Describe the template by answering questions, with --description and --keywords as the default answers",
+						},
+						cli.StringFlag{
+							Name:  "description",
+							Usage: "The template's description",
+						},
+						cli.StringFlag{
+							Name:  "keywords",
+							Usage: "The template's keywords, separated by commas",
+						},
+						cli.StringSliceFlag{
+							Name:  "image",
+							Value: &cli.StringSlice{},
+							Usage: "An image as NAME=SOURCE, or just SOURCE",
+						},
+						cli.StringSliceFlag{
+							Name:  "from-inspect",
+							Value: &cli.StringSlice{},
+							Usage: "A file holding 'docker inspect' output for local images to add with their ports, environment and volumes",
+						},
+						cli.StringSliceFlag{
+							Name:  "port",
+							Value: &cli.StringSlice{},
+							Usage: "A port as IMAGE=HOST:CONTAINER",
+						},
+						cli.StringSliceFlag{
+							Name:  "env",
+							Value: &cli.StringSlice{},
+							Usage: "An environment variable as IMAGE=VARIABLE=VALUE",
+						},
+						cli.StringSliceFlag{
+							Name:  "link",
+							Value: &cli.StringSlice{},
+							Usage: "A link as IMAGE=SERVICE:ALIAS",
+						},
+						cli.StringSliceFlag{
+							Name:  "volume",
+							Value: &cli.StringSlice{},
+							Usage: "A volume as IMAGE=HOST:CONTAINER",
+						},
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "Where to write the template, by default its name with a .pmx extension",
+						},
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "Overwrite the output file if it exists",
+						},
+					},
+				},
+				{
+					Name:        "fmt",
+					Usage:       "Rewrite templates in a canonical form",
+					Description: "Arguments are the paths to the templates. By default the formatted templates are output. YAML comments are not kept, so -w refuses to write templates that have them unless --force is given. Flags must come before the arguments.",
+					Before:      actionRequiresArgument("template path..."),
+					Action:      templateFmtAction,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "w",
+							Usage: "Write the formatted templates back to their files",
+						},
+						cli.BoolFlag{
+							Name:  "force",
+							Usage: "With -w, write templates even though their comments are removed",
+						},
+						cli.BoolFlag{
+							Name:  "check",
+							Usage: "List the templates that aren't formatted and fail if there are any",
+						},
+						cli.BoolFlag{
+							Name:  "sort-images",
+							Usage: "Order images by name rather than keeping them as written",
+						},
+					},
+				},
+				{
+					Name:        "render",
+					Usage:       "Show a template with the images of the templates it includes merged in",
+					Description: "Argument is the path to the template.",
+					Before:      actionRequiresArgument("template path"),
+					Action:      templateRenderAction,
+				},
+				{
+					Name:        "diff",
+					Usage:       "Compare what two templates deploy",
+					Description: "Arguments are the paths to the two templates. Flags must come before them.",
+					Before:      actionRequiresArgument("template path", "template path"),
+					Action:      templateDiffAction,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "mask-values",
+							Usage: "Hide the values of environment variables",
+						},
+					},
+				},
+				{
+					Name:        "graph",
+					Usage:       "Show how a template's images depend on each other",
+					Description: "Argument is the path to the template. Flags must come before it.",
+					Before:      actionRequiresArgument("template path"),
+					Action:      templateGraphAction,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "format",
+							Value: actions.GraphFormatTree,
+							Usage: "Output format: tree, dot or mermaid",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "doctor",
+			Usage:       "Diagnose configuration and connectivity problems",
+			Description: "Argument is optionally the name of the remote. When omitted, the active remote will be checked.",
+			Before:      actionRequiresArgument("optional:remote name"),
+			Action:      doctorAction,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all",
+					Usage: "Check every configured remote",
 				},
+				selectorFlag,
 			},
 		},
 		{
@@ -95,6 +426,21 @@ func init() {
 					Aliases: []string{"l"},
 					Usage:   "List deployments",
 					Action:  deploymentsListAction,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all-remotes",
+							Usage: "List the deployments on every remote",
+						},
+						selectorFlag,
+					},
+				},
+				{
+					Name:        "find",
+					Usage:       "Find deployments on every remote",
+					Description: "Argument is a pattern matched against each deployment's ID, name, and service IDs.",
+					Before:      actionRequiresArgument("pattern"),
+					Action:      findDeploymentsAction,
+					Flags:       []cli.Flag{selectorFlag},
 				},
 				{
 					Name:        "describe",
@@ -104,12 +450,140 @@ func init() {
 					Before:      actionRequiresArgument("deployment ID"),
 					Action:      describeDeploymentAction,
 				},
+				{
+					Name:        "graph",
+					Usage:       "Show how a deployment's services depend on each other",
+					Description: "Argument is a deployment ID. Flags must come before it.",
+					Before:      actionRequiresArgument("deployment ID"),
+					Action:      deploymentGraphAction,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "format",
+							Value: actions.GraphFormatTree,
+							Usage: "Output format: tree, dot or mermaid",
+						},
+					},
+				},
 				{
 					Name:        "create",
 					Usage:       "Deploy a template",
-					Description: "Argument is the path to a Panamax template.",
-					Before:      actionRequiresArgument("template path"),
+					Description: "Argument is the path to a Panamax template, or the name of one in the template catalog. Flags must come before it.",
+					Before:      actionRequiresArgument("template path or name"),
 					Action:      createDeploymentAction,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "remotes",
+							Usage: "Comma-separated names of remotes to deploy to instead of the active remote",
+						},
+						cli.BoolFlag{
+							Name:  "all-remotes",
+							Usage: "Deploy to every remote",
+						},
+						selectorFlag,
+						cli.StringFlag{
+							Name:  "overrides",
+							Usage: "Directory of override templates named after each remote, e.g. 'prod.pmx'",
+						},
+						cli.IntFlag{
+							Name:  "concurrency",
+							Value: 4,
+							Usage: "Maximum number of remotes to deploy to at once",
+						},
+						cli.BoolFlag{
+							Name:  "stop-on-error",
+							Usage: "Don't deploy to any more remotes after one fails",
+						},
+					},
+				},
+				{
+					Name:        "promote",
+					Usage:       "Recreate a deployment on another remote",
+					Description: "Argument is a deployment ID on the --from remote. Flags must come before it.",
+					Before:      actionRequiresArgument("deployment ID"),
+					Action:      promoteDeploymentAction,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "from",
+							Usage: "Remote the deployment is on, defaults to the active remote",
+						},
+						cli.StringFlag{
+							Name:  "to",
+							Usage: "Remote to promote the deployment to",
+						},
+						cli.StringFlag{
+							Name:  "template",
+							Usage: "Template to deploy, if it wasn't recorded when the deployment was created",
+						},
+						cli.StringFlag{
+							Name:  "overrides",
+							Usage: "Directory of override templates named after each remote, e.g. 'prod.pmx'",
+						},
+						cli.BoolFlag{
+							Name:  "wait",
+							Usage: "Wait for the new deployment's services to be running",
+						},
+						cli.DurationFlag{
+							Name:  "wait-timeout",
+							Value: 5 * time.Minute,
+							Usage: "How long to wait for the new deployment to be running",
+						},
+						cli.BoolFlag{
+							Name:  "replace",
+							Usage: "Delete deployments with the same name on the target remote",
+						},
+					},
+				},
+				{
+					Name:        "history",
+					Usage:       "List the deployments recorded in the local journal",
+					Description: "Optional argument is a deployment name. Flags must come before it.",
+					Action:      deploymentHistoryAction,
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "remote",
+							Usage: "Only list deployments on this remote",
+						},
+					},
+				},
+				{
+					Name:        "rollback",
+					Usage:       "Recreate a deployment from an earlier revision of its template",
+					Description: "Argument is a deployment name. Flags must come before it.",
+					Before:      actionRequiresArgument("deployment name"),
+					Action:      rollbackDeploymentAction,
+					Flags: []cli.Flag{
+						cli.IntFlag{
+							Name:  "to",
+							Usage: "Revision to roll back to, as shown by 'deployment history', defaults to the previous one",
+						},
+						cli.BoolFlag{
+							Name:  "wait",
+							Usage: "Wait for the recreated deployment's services to be running",
+						},
+						cli.DurationFlag{
+							Name:  "wait-timeout",
+							Value: 5 * time.Minute,
+							Usage: "How long to wait for the recreated deployment to be running",
+						},
+					},
+				},
+				{
+					Name:        "upgrade",
+					Usage:       "Replace a deployment with one created from a new template",
+					Description: "Arguments are a deployment ID or name, and the path to the new template. Flags must come before them.",
+					Before:      actionRequiresArgument("deployment ID or name", "template path"),
+					Action:      upgradeDeploymentAction,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "create-first",
+							Usage: "Create the new deployment and wait for it to be running before deleting the old one",
+						},
+						cli.DurationFlag{
+							Name:  "wait-timeout",
+							Value: 5 * time.Minute,
+							Usage: "How long to wait for the new deployment to be running with --create-first",
+						},
+					},
 				},
 				{
 					Name:        "redeploy",
@@ -141,22 +615,61 @@ func main() {
 	app.Flags = []cli.Flag{
 		cli.BoolFlag{
 			Name:  "debug",
-			Usage: "Enable verbose logging",
+			Usage: "Enable verbose logging, with credentials masked",
+		},
+		cli.BoolFlag{
+			Name:  "debug-unredacted",
+			Usage: "Enable verbose logging without masking credentials, other than resolved secrets, for local troubleshooting only",
+		},
+		cli.StringSliceFlag{
+			Name:   "redact-pattern",
+			Value:  &cli.StringSlice{},
+			Usage:  "Also mask the values of fields and environment variables whose names contain this, besides PASSWORD, SECRET, TOKEN and KEY",
+			EnvVar: "PMX_REDACT_PATTERNS",
 		},
 		cli.BoolFlag{
 			Name:  "insecure",
 			Usage: "Skip SSL certificate verification",
 		},
+		cli.StringFlag{
+			Name:  "ca-file",
+			Usage: "Also trust the certificates in this PEM file, besides the ones in the remotes' tokens and CA bundles",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "How long to wait for each call to a remote, instead of the remote's own timeouts, e.g. '5m'",
+		},
+		cli.IntFlag{
+			Name:   "max-attempts",
+			Value:  agentclient.DefaultRetryPolicy.MaxAttempts,
+			Usage:  "How many times to try a call to a remote that fails with a connection error or an unavailable agent, 1 to never retry",
+			EnvVar: "PMX_MAX_ATTEMPTS",
+		},
+		cli.DurationFlag{
+			Name:   "retry-backoff",
+			Value:  agentclient.DefaultRetryPolicy.Backoff,
+			Usage:  "How long to wait before the first retry, doubling for each one after it",
+			EnvVar: "PMX_RETRY_BACKOFF",
+		},
 	}
 
 	app.Run(os.Args)
 }
 
 func initializeApp(c *cli.Context) error {
-	if c.GlobalBool("debug") {
+	if c.GlobalBool("debug") || c.GlobalBool("debug-unredacted") {
 		// Remote Agent Client will write to logrus with helpful info!
 		log.SetLevel(log.DebugLevel)
 	}
+	// That info includes the request bodies, with every environment variable
+	// in a template, so mask credentials before they're logged. Secrets
+	// resolved while deploying are never logged, even with --debug-unredacted.
+	hook := redact.Hook{}
+	if !c.GlobalBool("debug-unredacted") {
+		r := redact.New(c.GlobalStringSlice("redact-pattern")...)
+		hook.Redactor = &r
+	}
+	log.AddHook(hook)
 
 	if c.GlobalBool("insecure") {
 		// Remote Agent Client will not verify SSL cert. This is probably bad, but
@@ -164,11 +677,27 @@ func initializeApp(c *cli.Context) error {
 		client.SkipSSLVerify = true
 	}
 
+	actions.CommandTimeout = c.GlobalDuration("timeout")
+	actions.CommandCAFile = c.GlobalString("ca-file")
+	if c.GlobalInt("max-attempts") < 1 {
+		err := errors.New("--max-attempts must be at least 1")
+		log.Error(err)
+		return err
+	}
+	agentclient.DefaultRetryPolicy.MaxAttempts = c.GlobalInt("max-attempts")
+	agentclient.DefaultRetryPolicy.Backoff = c.GlobalDuration("retry-backoff")
+
 	// Surprise! CLI wants an error from this method but, only uses it to abort
 	// execution, not for display anywhere.
 	if err := loadConfig(c); err != nil {
-		log.Error(err)
-		return err
+		if c.Args().First() != "doctor" {
+			log.Error(err)
+			return err
+		}
+
+		// The doctor command reports on a broken configuration itself, so let
+		// it run against an empty one.
+		Config = config.Config(&config.FileConfig{})
 	}
 
 	return nil
@@ -186,6 +715,15 @@ func loadConfig(c *cli.Context) error {
 	}
 	Config = config.Config(&fileConfig)
 
+	dir := filepath.Dir(path)
+	actions.DefaultJournal = &config.FileJournal{
+		Path:        filepath.Join(dir, "journal"),
+		TemplateDir: filepath.Join(dir, "templates"),
+	}
+	if s := Config.SecretStore(); s != nil {
+		actions.DefaultSecretStore = actions.OpenSecretStore(*s)
+	}
+
 	return nil
 }
 
@@ -195,10 +733,16 @@ func actionRequiresArgument(args ...string) func(c *cli.Context) error {
 		for i, arg := range args {
 			if strings.HasPrefix(arg, "optional:") {
 				requiredCount = i
+				break
 			}
 		}
 
-		if len(c.Args()) < requiredCount || len(c.Args()) > len(args) {
+		maxCount := len(args)
+		if len(args) > 0 && strings.HasSuffix(args[len(args)-1], "...") {
+			maxCount = -1
+		}
+
+		if len(c.Args()) < requiredCount || (maxCount >= 0 && len(c.Args()) > maxCount) {
 			s := strings.Join(args, ", ")
 			message := fmt.Sprintf("This command requires the following arguments: %s", s)
 			log.Errorln(message)
@@ -212,7 +756,7 @@ func actionRequiresArgument(args ...string) func(c *cli.Context) error {
 func actionRequiresActiveRemote(c *cli.Context) error {
 	arg := c.Args().First()
 	isHelp := (arg == "help" || arg == "h")
-	if !isHelp && Config.Active() == nil {
+	if !isHelp && !targetsManyRemotes(c.Args()) && Config.Active() == nil {
 		message := "an active remote is required for this command"
 		log.Errorln(message)
 		return errors.New(message)
@@ -221,11 +765,64 @@ func actionRequiresActiveRemote(c *cli.Context) error {
 	return nil
 }
 
+// targetsManyRemotes is true for deployment commands that act on remotes
+// other than the active one, and so can be run without an active remote.
+func targetsManyRemotes(args cli.Args) bool {
+	switch args.First() {
+	case "find", "promote", "history":
+		return true
+	}
+	for _, a := range args.Tail() {
+		for _, f := range []string{"--all-remotes", "--remotes", "--selector"} {
+			if strings.HasPrefix(a, f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isMultiRemote is true when a command's flags select remotes to act on,
+// rather than leaving it to act on the active remote.
+func isMultiRemote(c *cli.Context) bool {
+	return c.Bool("all-remotes") || c.String("remotes") != "" || c.String("selector") != ""
+}
+
+// selectedRemotes returns the remotes named by a command's --remotes flag, or
+// every remote when it wasn't given, narrowed down to those matching its
+// --selector flag.
+func selectedRemotes(c *cli.Context) ([]config.Remote, error) {
+	selector, err := config.ParseLabels(c.String("selector"))
+	if err != nil {
+		return nil, err
+	}
+
+	remotes := Config.Remotes()
+	if c.String("remotes") != "" {
+		remotes = nil
+		for _, name := range strings.Split(c.String("remotes"), ",") {
+			r, err := Config.Get(strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+			remotes = append(remotes, r)
+		}
+	}
+
+	return config.SelectRemotes(remotes, selector), nil
+}
+
 func remoteAddAction(c *cli.Context) {
 	name := c.Args().First()
 	path := c.Args().Get(1)
 
-	output, err := actions.AddRemoteByPath(Config, name, path)
+	var output prettycli.Output
+	var err error
+	if c.String("client-cert") != "" || c.String("client-key") != "" {
+		output, err = actions.AddRemoteWithClientCert(Config, name, path, c.String("client-cert"), c.String("client-key"))
+	} else {
+		output, err = actions.AddRemoteByPath(Config, name, path)
+	}
 	if err != nil {
 		fatalError(err)
 	}
@@ -244,7 +841,99 @@ func removeRemoteAction(c *cli.Context) {
 }
 
 func remoteListAction(c *cli.Context) {
-	output := actions.ListRemotes(Config)
+	selector, err := config.ParseLabels(c.String("selector"))
+	if err != nil {
+		fatalError(err)
+	}
+
+	output := actions.ListRemotes(Config, selector)
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func remoteStatusAction(c *cli.Context) {
+	remotes, err := selectedRemotes(c)
+	if err != nil {
+		fatalError(err)
+	}
+
+	output := actions.RemoteStatus(remotes, c.Duration("timeout"))
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func remoteTimeoutAction(c *cli.Context) {
+	var output prettycli.Output
+	var err error
+	if c.Bool("reset") {
+		output, err = actions.ResetRemoteTimeouts(Config, c.Args().First())
+	} else if c.Duration("read") != 0 || c.Duration("mutate") != 0 {
+		output, err = actions.SetRemoteTimeouts(Config, c.Args().First(), config.Timeouts{
+			Read:   config.Duration(c.Duration("read")),
+			Mutate: config.Duration(c.Duration("mutate")),
+		})
+	} else {
+		err = errors.New("give a --read or --mutate timeout, or --reset")
+	}
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func remoteProxyAction(c *cli.Context) {
+	output, err := actions.SetRemoteProxy(Config, c.Args().First(), c.Args().Get(1))
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func remoteCABundleAction(c *cli.Context) {
+	output, err := actions.SetRemoteCABundle(Config, c.Args().First(), c.Args().Get(1))
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func remoteClientCertAction(c *cli.Context) {
+	output, err := actions.SetRemoteClientCert(Config, c.Args().First(), c.Args().Get(1), c.Args().Get(2))
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func labelRemoteAction(c *cli.Context) {
+	labels, err := config.ParseLabels(c.Args().Get(1))
+	if err != nil {
+		fatalError(err)
+	}
+
+	output, err := actions.LabelRemote(Config, c.Args().First(), labels)
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func unlabelRemoteAction(c *cli.Context) {
+	var keys []string
+	for _, k := range strings.Split(c.Args().Get(1), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	output, err := actions.UnlabelRemote(Config, c.Args().First(), keys)
+	if err != nil {
+		fatalError(err)
+	}
+
 	fmt.Println(output.ToPrettyOutput())
 }
 
@@ -274,16 +963,58 @@ func setActiveRemoteAction(c *cli.Context) {
 }
 
 func deploymentsListAction(c *cli.Context) {
-	output, err := actions.ListDeployments(*Config.Active())
+	var output prettycli.Output
+	var err error
+	if isMultiRemote(c) {
+		var remotes []config.Remote
+		if remotes, err = selectedRemotes(c); err != nil {
+			fatalError(err)
+		}
+		output, err = actions.ListAllDeployments(remotes)
+	} else {
+		output, err = actions.ListDeployments(*Config.Active())
+	}
+
+	if err != nil {
+		fatalError(err)
+	}
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func findDeploymentsAction(c *cli.Context) {
+	remotes, err := selectedRemotes(c)
+	if err != nil {
+		fatalError(err)
+	}
 
+	output, err := actions.FindDeployments(remotes, c.Args().First())
 	if err != nil {
 		fatalError(err)
 	}
+
 	fmt.Println(output.ToPrettyOutput())
 }
 
+func deploymentGraphAction(c *cli.Context) {
+	output, err := actions.DeploymentGraph(*Config.Active(), c.Args().First(), c.String("format"))
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
 func createDeploymentAction(c *cli.Context) {
-	path := c.Args().First()
+	path, err := actions.ResolveTemplatePath(Config, c.Args().First())
+	if err != nil {
+		fatalError(err)
+	}
+	if isMultiRemote(c) || c.String("overrides") != "" {
+		createDeploymentsAction(c, path)
+		return
+	}
+
 	output, err := actions.CreateDeployment(*Config.Active(), path)
 	if err != nil {
 		fatalError(err)
@@ -292,6 +1023,32 @@ func createDeploymentAction(c *cli.Context) {
 	fmt.Println(output.ToPrettyOutput())
 }
 
+func createDeploymentsAction(c *cli.Context, path string) {
+	var remotes []config.Remote
+	var err error
+	if isMultiRemote(c) {
+		remotes, err = selectedRemotes(c)
+	} else {
+		remotes = []config.Remote{*Config.Active()}
+	}
+	if err != nil {
+		fatalError(err)
+	}
+
+	opts := actions.MultiCreateOptions{
+		OverrideDir: c.String("overrides"),
+		Concurrency: c.Int("concurrency"),
+		StopOnError: c.Bool("stop-on-error"),
+	}
+	output, err := actions.CreateDeployments(remotes, path, opts)
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
 func describeDeploymentAction(c *cli.Context) {
 	name := c.Args().First()
 	output, err := actions.DescribeDeployment(*Config.Active(), name)
@@ -302,6 +1059,81 @@ func describeDeploymentAction(c *cli.Context) {
 	fmt.Println(output.ToPrettyOutput())
 }
 
+func promoteDeploymentAction(c *cli.Context) {
+	if c.String("to") == "" {
+		fatalError(errors.New("the --to remote is required"))
+	}
+	to, err := Config.Get(c.String("to"))
+	if err != nil {
+		fatalError(err)
+	}
+
+	var from config.Remote
+	if c.String("from") != "" {
+		from, err = Config.Get(c.String("from"))
+	} else if Config.Active() != nil {
+		from = *Config.Active()
+	} else {
+		err = errors.New("you must provide a --from remote or set an active remote")
+	}
+	if err != nil {
+		fatalError(err)
+	}
+
+	opts := actions.PromoteOptions{
+		TemplatePath: c.String("template"),
+		OverrideDir:  c.String("overrides"),
+		Wait:         c.Bool("wait"),
+		WaitTimeout:  c.Duration("wait-timeout"),
+		Replace:      c.Bool("replace"),
+	}
+	output, err := actions.PromoteDeployment(from, to, c.Args().First(), opts)
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
+func deploymentHistoryAction(c *cli.Context) {
+	output, err := actions.DeploymentHistory(c.String("remote"), c.Args().First())
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func rollbackDeploymentAction(c *cli.Context) {
+	opts := actions.RollbackOptions{
+		To:          c.Int("to"),
+		Wait:        c.Bool("wait"),
+		WaitTimeout: c.Duration("wait-timeout"),
+	}
+	output, err := actions.RollbackDeployment(*Config.Active(), c.Args().First(), opts)
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
+func upgradeDeploymentAction(c *cli.Context) {
+	opts := actions.UpgradeOptions{
+		CreateFirst: c.Bool("create-first"),
+		WaitTimeout: c.Duration("wait-timeout"),
+	}
+	output, err := actions.UpgradeDeployment(*Config.Active(), c.Args()[0], c.Args()[1], opts)
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
 func redeployDeploymentAction(c *cli.Context) {
 	name := c.Args().First()
 	output, err := actions.RedeployDeployment(*Config.Active(), name)
@@ -329,7 +1161,158 @@ func getTokenAction(c *cli.Context) {
 		return
 	}
 
-	output, err := actions.GetRemoteToken(Config, name)
+	opts := actions.TokenOptions{
+		Reveal:   c.Bool("reveal"),
+		CopyPath: c.String("copy"),
+		QR:       c.Bool("qr"),
+	}
+	output, err := actions.GetRemoteToken(Config, name, opts)
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func applyAction(c *cli.Context) {
+	path := c.String("file")
+	if path == "" {
+		fatalError(errors.New("a manifest is required, pass it with --file"))
+	}
+
+	opts := actions.ApplyOptions{Prune: c.Bool("prune"), Yes: c.Bool("yes")}
+	output, err := actions.Apply(Config, path, opts)
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
+func secretStoreAction(c *cli.Context) {
+	output, err := actions.SetSecretStore(Config, c.Args()[0], c.Args()[1])
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func secretSetAction(c *cli.Context) {
+	value, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		fatalError(err)
+	}
+
+	output, err := actions.SetSecret(c.Args().First(), string(value))
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func secretListAction(c *cli.Context) {
+	output, err := actions.ListSecrets()
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func secretRemoveAction(c *cli.Context) {
+	output, err := actions.RemoveSecret(c.Args().First())
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func templateRepoAddAction(c *cli.Context) {
+	output, err := actions.AddTemplateRepo(Config, c.Args().First())
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func templateRepoListAction(c *cli.Context) {
+	fmt.Println(actions.ListTemplateRepos(Config).ToPrettyOutput())
+}
+
+func templateRepoRemoveAction(c *cli.Context) {
+	output, err := actions.RemoveTemplateRepo(Config, c.Args().First())
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func templateSearchAction(c *cli.Context) {
+	output, err := actions.SearchTemplates(Config, c.Args().First())
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func templateShowAction(c *cli.Context) {
+	output, err := actions.ShowTemplate(Config, c.Args().First())
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func templateNewAction(c *cli.Context) {
+	opts := actions.NewTemplateOptions{
+		Description:  c.String("description"),
+		Keywords:     c.String("keywords"),
+		Images:       c.StringSlice("image"),
+		InspectPaths: c.StringSlice("from-inspect"),
+		Ports:        c.StringSlice("port"),
+		Environment:  c.StringSlice("env"),
+		Links:        c.StringSlice("link"),
+		Volumes:      c.StringSlice("volume"),
+		Output:       c.String("output"),
+		Force:        c.Bool("force"),
+		Interactive:  c.Bool("interactive"),
+		In:           os.Stdin,
+		Out:          os.Stdout,
+	}
+	output, err := actions.NewTemplate(c.Args().First(), opts)
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func templateFmtAction(c *cli.Context) {
+	opts := actions.FormatOptions{
+		Write:      c.Bool("w"),
+		Force:      c.Bool("force"),
+		Check:      c.Bool("check"),
+		SortImages: c.Bool("sort-images"),
+	}
+	output, err := actions.FormatTemplates(c.Args(), opts)
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
+func templateRenderAction(c *cli.Context) {
+	output, err := actions.RenderTemplate(c.Args().First())
 	if err != nil {
 		fatalError(err)
 	}
@@ -337,6 +1320,56 @@ func getTokenAction(c *cli.Context) {
 	fmt.Println(output.ToPrettyOutput())
 }
 
+func templateDiffAction(c *cli.Context) {
+	output, err := actions.DiffTemplates(c.Args()[0], c.Args()[1], c.Bool("mask-values"))
+	if err != nil {
+		fatalError(err)
+	}
+
+	fmt.Println(output.ToPrettyOutput())
+}
+
+func templateGraphAction(c *cli.Context) {
+	output, err := actions.TemplateGraph(c.Args().First(), c.String("format"))
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
+func doctorAction(c *cli.Context) {
+	path, err := makeConfigPath()
+	if err != nil {
+		fatalError(err)
+	}
+
+	var names []string
+	if c.Bool("all") || c.String("selector") != "" {
+		remotes, err := selectedRemotes(c)
+		if err != nil {
+			fatalError(err)
+		}
+		if len(remotes) == 0 && c.String("selector") != "" {
+			fatalError(fmt.Errorf("no remotes match the selector '%s'", c.String("selector")))
+		}
+		for _, r := range remotes {
+			names = append(names, r.Name)
+		}
+	} else if name, err := explicitOrActiveRemoteName(c); err == nil {
+		names = append(names, name)
+	}
+
+	output, err := actions.Doctor(Config, path, names)
+	if s := output.ToPrettyOutput(); s != "" {
+		fmt.Println(s)
+	}
+	if err != nil {
+		fatalError(err)
+	}
+}
+
 func fatalError(err error) {
 	if uErr, ok := err.(*url.Error); ok {
 		if hErr, ok := uErr.Err.(x509.HostnameError); ok {
@@ -36,3 +36,24 @@ func TestErroredTooManyActionRequiresArgument(t *testing.T) {
 	c := contextWithFlags("one", "two", "three")
 	assert.EqualError(t, requiredFn(c), "This command requires the following arguments: first, second")
 }
+
+func TestSeveralOptionalActionRequiresArgument(t *testing.T) {
+	fn := actionRequiresArgument("first", "optional:second", "optional:third")
+	assert.NoError(t, fn(contextWithFlags("one")))
+	assert.NoError(t, fn(contextWithFlags("one", "two", "three")))
+	assert.Error(t, fn(contextWithFlags()))
+}
+
+func TestRepeatedActionRequiresArgument(t *testing.T) {
+	fn := actionRequiresArgument("path...")
+	assert.NoError(t, fn(contextWithFlags("one", "two", "three")))
+	assert.EqualError(t, fn(contextWithFlags()), "This command requires the following arguments: path...")
+}
+
+func TestTargetsManyRemotes(t *testing.T) {
+	assert.True(t, targetsManyRemotes(cli.Args{"find", "wordpress"}))
+	assert.True(t, targetsManyRemotes(cli.Args{"history"}))
+	assert.True(t, targetsManyRemotes(cli.Args{"list", "--all-remotes"}))
+	assert.False(t, targetsManyRemotes(cli.Args{"list"}))
+	assert.False(t, targetsManyRemotes(cli.Args{"--all-remotes"}))
+}
@@ -0,0 +1,160 @@
+// Package redact masks credentials in text before it's logged: the values of
+// fields and environment variables with sensitive names, such as
+// "DB_PASSWORD" or "token", basic auth headers and credentials, and
+// certificates and keys in PEM form.
+//
+// It works on the text rather than parsing it, so it can be used on request
+// and response bodies as well as log messages, and leaves the text as it was
+// apart from the masked values.
+package redact
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamaxcli/secret"
+	log "github.com/Sirupsen/logrus"
+)
+
+// Mask replaces each redacted value.
+const Mask = "*****"
+
+// DefaultPatterns are the parts of names that mark their values as sensitive.
+var DefaultPatterns = []string{"PASSWORD", "SECRET", "TOKEN", "KEY"}
+
+var (
+	// jsonField matches a JSON field with a string value.
+	jsonField = regexp.MustCompile(`"([^"\\]+)"(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	// environmentPair matches an environment variable in a template or
+	// blueprint, whose name and value are separate fields.
+	environmentPair = regexp.MustCompile(`(?i)("variable"\s*:\s*"([^"\\]*)"\s*,\s*"value"\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	reversedPair    = regexp.MustCompile(`(?i)("value"\s*:\s*)"((?:[^"\\]|\\.)*)"(\s*,\s*"variable"\s*:\s*"([^"\\]*)")`)
+	// assignment matches NAME=value, as in Docker's environment lists and
+	// query strings.
+	assignment = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_.-]*)=([^\s"&,;\])]+)`)
+	authHeader = regexp.MustCompile(`(?i)\b(Basic|Bearer)\s+[A-Za-z0-9+/._~-]+=*`)
+	userinfo   = regexp.MustCompile(`(://[^/\s:@"]+:)[^/\s@"]+@`)
+	pem        = regexp.MustCompile(`(?s)-----BEGIN ([A-Z0-9 ]+)-----.*?-----END [A-Z0-9 ]+-----`)
+)
+
+// A Redactor masks the values of names that contain any of its patterns,
+// ignoring case, along with auth credentials and PEM blocks.
+type Redactor struct {
+	Patterns []string
+}
+
+// New returns a Redactor for the default patterns and any extra ones.
+func New(extra ...string) Redactor {
+	patterns := append([]string{}, DefaultPatterns...)
+	for _, p := range extra {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return Redactor{Patterns: patterns}
+}
+
+// Sensitive is true when the name contains one of the patterns.
+func (r Redactor) Sensitive(name string) bool {
+	name = strings.ToUpper(name)
+	for _, p := range r.Patterns {
+		if strings.Contains(name, strings.ToUpper(p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact masks the sensitive values in s.
+func (r Redactor) Redact(s string) string {
+	s = pem.ReplaceAllString(s, "-----BEGIN $1----- "+Mask+" -----END $1-----")
+	s = authHeader.ReplaceAllString(s, "$1 "+Mask)
+	s = userinfo.ReplaceAllString(s, "${1}"+Mask+"@")
+	s = replaceSubmatches(environmentPair, s, func(m []string) string {
+		if r.Sensitive(m[2]) {
+			return m[1] + `"` + Mask + `"`
+		}
+		return m[0]
+	})
+	s = replaceSubmatches(reversedPair, s, func(m []string) string {
+		if r.Sensitive(m[4]) {
+			return m[1] + `"` + Mask + `"` + m[3]
+		}
+		return m[0]
+	})
+	s = replaceSubmatches(jsonField, s, func(m []string) string {
+		if r.Sensitive(m[1]) {
+			return `"` + m[1] + `"` + m[2] + `"` + Mask + `"`
+		}
+		return m[0]
+	})
+	s = replaceSubmatches(assignment, s, func(m []string) string {
+		if r.Sensitive(m[1]) {
+			return m[1] + "=" + Mask
+		}
+		return m[0]
+	})
+	return s
+}
+
+// replaceSubmatches replaces each match of re in s with the result of
+// replace, which is given the match and its submatches.
+func replaceSubmatches(re *regexp.Regexp, s string, replace func([]string) string) string {
+	var b bytes.Buffer
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		m := make([]string, len(loc)/2)
+		for i := range m {
+			if loc[2*i] >= 0 {
+				m[i] = s[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(replace(m))
+		last = loc[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// Hook is a logrus hook that redacts the message and fields of every entry:
+// the secrets concealed while resolving templates always, and the values the
+// Redactor masks unless it's nil.
+type Hook struct {
+	Redactor *Redactor
+}
+
+// Levels implements the logrus.Hook interface.
+func (Hook) Levels() []log.Level {
+	return []log.Level{
+		log.PanicLevel,
+		log.FatalLevel,
+		log.ErrorLevel,
+		log.WarnLevel,
+		log.InfoLevel,
+		log.DebugLevel,
+	}
+}
+
+// Fire implements the logrus.Hook interface.
+func (h Hook) Fire(e *log.Entry) error {
+	e.Message = h.redact(e.Message)
+	for k, v := range e.Data {
+		switch v := v.(type) {
+		case string:
+			e.Data[k] = h.redact(v)
+		case error:
+			e.Data[k] = h.redact(v.Error())
+		}
+	}
+	return nil
+}
+
+func (h Hook) redact(s string) string {
+	s = secret.Redact(s)
+	if h.Redactor != nil {
+		s = h.Redactor.Redact(s)
+	}
+	return s
+}
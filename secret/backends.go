@@ -0,0 +1,266 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// PassphraseEnv is the environment variable that holds the passphrase for an
+// encrypted file of secrets.
+const PassphraseEnv = "PMX_SECRETS_PASSPHRASE"
+
+// Dir is a directory with a file for each secret, named after it, such as
+// "db/password". Trailing newlines in the files are ignored.
+type Dir struct {
+	Path string
+}
+
+func (d Dir) path(name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(d.Path, filepath.FromSlash(name)), nil
+}
+
+// Get implements the Store interface.
+func (d Dir) Get(name string) (string, error) {
+	path, err := d.path(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("secret '%s' does not exist", name)
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Set implements the WritableStore interface.
+func (d Dir) Set(name string, value string) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(value), 0600)
+}
+
+// Remove implements the WritableStore interface.
+func (d Dir) Remove(name string) error {
+	path, err := d.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return fmt.Errorf("secret '%s' does not exist", name)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Names implements the WritableStore interface.
+func (d Dir) Names() ([]string, error) {
+	var names []string
+	err := filepath.Walk(d.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != d.Path && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(d.Path, path)
+			if err != nil {
+				return err
+			}
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// File is a single file of secrets, encrypted with AES-GCM using a key
+// derived from a passphrase.
+type File struct {
+	Path       string
+	Passphrase string
+}
+
+// pbkdf2Iterations is how many times the passphrase is hashed to make the key,
+// to slow down guessing it.
+const pbkdf2Iterations = 100000
+
+// encryptedFile is how a File is stored.
+type encryptedFile struct {
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Get implements the Store interface.
+func (f File) Get(name string) (string, error) {
+	secrets, err := f.load()
+	if err != nil {
+		return "", err
+	}
+	value, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret '%s' does not exist", name)
+	}
+	return value, nil
+}
+
+// Set implements the WritableStore interface.
+func (f File) Set(name string, value string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	secrets, err := f.load()
+	if err != nil {
+		return err
+	}
+	secrets[name] = value
+	return f.save(secrets)
+}
+
+// Remove implements the WritableStore interface.
+func (f File) Remove(name string) error {
+	secrets, err := f.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[name]; !ok {
+		return fmt.Errorf("secret '%s' does not exist", name)
+	}
+	delete(secrets, name)
+	return f.save(secrets)
+}
+
+// Names implements the WritableStore interface.
+func (f File) Names() ([]string, error) {
+	secrets, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for n := range secrets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// load decrypts the file, which is treated as empty when it doesn't exist.
+func (f File) load() (map[string]string, error) {
+	if f.Passphrase == "" {
+		return nil, fmt.Errorf("set %s to the passphrase for '%s'", PassphraseEnv, f.Path)
+	}
+	secrets := make(map[string]string)
+	b, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return secrets, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var ef encryptedFile
+	if err := json.Unmarshal(b, &ef); err != nil {
+		return nil, fmt.Errorf("'%s' is not an encrypted file of secrets", f.Path)
+	}
+	gcm, err := newGCM(f.Passphrase, ef.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, ef.Nonce, ef.Ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("the passphrase for '%s' is wrong, or the file is corrupt", f.Path)
+	}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// save encrypts the secrets with a new salt and nonce and writes them out.
+func (f File) save(secrets map[string]string) error {
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+
+	ef := encryptedFile{Salt: make([]byte, 16)}
+	if _, err := rand.Read(ef.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(f.Passphrase, ef.Salt)
+	if err != nil {
+		return err
+	}
+	ef.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(ef.Nonce); err != nil {
+		return err
+	}
+	ef.Ciphertext = gcm.Seal(nil, ef.Nonce, plaintext, nil)
+
+	b, err := json.Marshal(ef)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.Path, b, 0600)
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, pbkdf2Iterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Exec runs a helper command to look up each secret, such as one that reads
+// from a password manager. The command is run with the secret's name as its
+// last argument, and its output, without trailing newlines, is the value.
+type Exec struct {
+	Command string
+}
+
+// Get implements the Store interface.
+func (e Exec) Get(name string) (string, error) {
+	args := strings.Fields(e.Command)
+	if len(args) == 0 {
+		return "", fmt.Errorf("no secret helper command is set")
+	}
+	cmd := exec.Command(args[0], append(args[1:], name)...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("the secret helper failed to look up '%s': %s", name, err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
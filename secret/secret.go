@@ -0,0 +1,105 @@
+// Package secret resolves references to secrets, such as
+// "secret://db/password", from a local store so that their values never need
+// to be written in templates.
+//
+// Values that have been read from a store are remembered, and Redact
+// replaces them, so that the log hook in the redact package can keep them out
+// of anything that's logged.
+package secret
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Scheme prefixes the name of a secret in a reference.
+const Scheme = "secret://"
+
+// Mask replaces the value of a secret in logs.
+const Mask = "*****"
+
+// A Store looks up secrets by name. Names are paths separated by slashes,
+// such as "db/password".
+type Store interface {
+	Get(name string) (string, error)
+}
+
+// A WritableStore can also change the secrets in it.
+type WritableStore interface {
+	Store
+	Set(name string, value string) error
+	Remove(name string) error
+	Names() ([]string, error)
+}
+
+// Reference returns the name of the secret that v refers to, or false when v
+// isn't a reference.
+func Reference(v string) (string, bool) {
+	if !strings.HasPrefix(v, Scheme) {
+		return "", false
+	}
+	return strings.TrimPrefix(v, Scheme), true
+}
+
+// ValidateName checks that the name can't be used to escape a store, as
+// "../" could from a directory.
+func ValidateName(name string) error {
+	if name == "" || strings.HasPrefix(name, "/") {
+		return fmt.Errorf("'%s' is not a valid secret name", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("'%s' is not a valid secret name", name)
+		}
+	}
+	return nil
+}
+
+// Resolve looks up the secret that v refers to in the store, or returns v
+// when it isn't a reference. The value is concealed from the logs.
+func Resolve(s Store, v string) (string, error) {
+	name, ok := Reference(v)
+	if !ok {
+		return v, nil
+	}
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	value, err := s.Get(name)
+	if err != nil {
+		return "", err
+	}
+	Conceal(value)
+	return value, nil
+}
+
+var concealed = struct {
+	sync.Mutex
+	values []string
+}{}
+
+// Conceal hides the value from anything that's logged from now on.
+func Conceal(value string) {
+	if value == "" {
+		return
+	}
+	concealed.Lock()
+	defer concealed.Unlock()
+	for _, v := range concealed.values {
+		if v == value {
+			return
+		}
+	}
+	concealed.values = append(concealed.values, value)
+}
+
+// Redact replaces each concealed value in s.
+func Redact(s string) string {
+	concealed.Lock()
+	defer concealed.Unlock()
+	for _, v := range concealed.values {
+		s = strings.Replace(s, v, Mask, -1)
+	}
+	return s
+}
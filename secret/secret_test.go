@@ -0,0 +1,123 @@
+package secret
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore map[string]string
+
+func (s fakeStore) Get(name string) (string, error) {
+	if v, ok := s[name]; ok {
+		return v, nil
+	}
+	return "", errors.New("missing")
+}
+
+func TestReference(t *testing.T) {
+	name, ok := Reference("secret://db/password")
+	assert.True(t, ok)
+	assert.Equal(t, "db/password", name)
+
+	_, ok = Reference("password")
+	assert.False(t, ok)
+}
+
+func TestValidateName(t *testing.T) {
+	assert.NoError(t, ValidateName("db/password"))
+	for _, name := range []string{"", "/etc/passwd", "../x", "db/../../x", "db//x", "db/"} {
+		assert.EqualError(t, ValidateName(name), "'"+name+"' is not a valid secret name")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	s := fakeStore{"db/password": "resolve-secret"}
+
+	v, err := Resolve(s, "secret://db/password")
+	assert.NoError(t, err)
+	assert.Equal(t, "resolve-secret", v)
+	assert.Equal(t, "password is *****", Redact("password is resolve-secret"))
+
+	v, err = Resolve(s, "plain")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", v)
+
+	_, err = Resolve(s, "secret://missing")
+	assert.EqualError(t, err, "missing")
+	_, err = Resolve(s, "secret://../x")
+	assert.Error(t, err)
+}
+
+func TestDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmx-secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	d := Dir{Path: dir}
+
+	assert.NoError(t, d.Set("db/password", "pass@word01"))
+	ioutil.WriteFile(filepath.Join(dir, "token"), []byte("abc\n"), 0600)
+	ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0600)
+
+	v, err := d.Get("db/password")
+	assert.NoError(t, err)
+	assert.Equal(t, "pass@word01", v)
+	v, err = d.Get("token")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", v)
+
+	names, err := d.Names()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db/password", "token"}, names)
+
+	assert.NoError(t, d.Remove("token"))
+	_, err = d.Get("token")
+	assert.EqualError(t, err, "secret 'token' does not exist")
+	assert.EqualError(t, d.Remove("token"), "secret 'token' does not exist")
+	_, err = d.Get("../token")
+	assert.Error(t, err)
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pmx-secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets")
+	f := File{Path: path, Passphrase: "correct horse"}
+
+	assert.NoError(t, f.Set("db/password", "pass@word01"))
+	assert.NoError(t, f.Set("api/key", "key"))
+	b, _ := ioutil.ReadFile(path)
+	assert.NotContains(t, string(b), "pass@word01")
+
+	v, err := f.Get("db/password")
+	assert.NoError(t, err)
+	assert.Equal(t, "pass@word01", v)
+	names, err := f.Names()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"api/key", "db/password"}, names)
+
+	assert.NoError(t, f.Remove("api/key"))
+	_, err = f.Get("api/key")
+	assert.EqualError(t, err, "secret 'api/key' does not exist")
+
+	_, err = File{Path: path, Passphrase: "wrong"}.Get("db/password")
+	assert.EqualError(t, err, "the passphrase for '"+path+"' is wrong, or the file is corrupt")
+	_, err = File{Path: path}.Get("db/password")
+	assert.EqualError(t, err, "set PMX_SECRETS_PASSPHRASE to the passphrase for '"+path+"'")
+}
+
+func TestExec(t *testing.T) {
+	v, err := Exec{Command: "echo value-of"}.Get("db/password")
+	assert.NoError(t, err)
+	assert.Equal(t, "value-of db/password", v)
+
+	_, err = Exec{Command: "false"}.Get("db/password")
+	assert.Contains(t, err.Error(), "the secret helper failed to look up 'db/password'")
+	_, err = Exec{}.Get("db/password")
+	assert.EqualError(t, err, "no secret helper command is set")
+}
@@ -0,0 +1,277 @@
+// Package template models the complete Panamax template format. The agent's
+// own model only knows about the parts of a template needed to deploy it, so
+// it silently drops metadata like descriptions, keywords and documentation.
+//
+// Parsing and marshalling a template is lossless: fields that the model
+// doesn't know about are kept in each struct's Extra map and written back out
+// after the known fields.
+package template
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"gopkg.in/yaml.v2"
+)
+
+// A Template is a complete Panamax template.
+type Template struct {
+	Name          string   `yaml:"name,omitempty"`
+	Description   string   `yaml:"description,omitempty"`
+	Keywords      string   `yaml:"keywords,omitempty"`
+	Type          string   `yaml:"type,omitempty"`
+	Recommended   *bool    `yaml:"recommended,omitempty"`
+	Documentation string   `yaml:"documentation,omitempty"`
+	Authors       []string `yaml:"authors,omitempty"`
+	// Include lists the paths of other templates whose images are merged
+	// into this one's by Resolve. Relative paths are relative to the
+	// template's own directory.
+	Include []string `yaml:"include,omitempty"`
+	Images  []Image  `yaml:"images,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// An Image is a single service in a template.
+type Image struct {
+	Name        string        `yaml:"name,omitempty"`
+	Source      string        `yaml:"source,omitempty"`
+	Description string        `yaml:"description,omitempty"`
+	Category    string        `yaml:"category,omitempty"`
+	Type        string        `yaml:"type,omitempty"`
+	Command     string        `yaml:"command,omitempty"`
+	Deployment  *Deployment   `yaml:"deployment,omitempty"`
+	Links       []Link        `yaml:"links,omitempty"`
+	Environment []Environment `yaml:"environment,omitempty"`
+	Ports       []Port        `yaml:"ports,omitempty"`
+	Expose      []IntOrString `yaml:"expose,omitempty"`
+	Volumes     []Volume      `yaml:"volumes,omitempty"`
+	VolumesFrom []string      `yaml:"volumes_from,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// Deployment holds orchestrator specific settings for an image.
+type Deployment struct {
+	Count IntOrString `yaml:"count,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// A Link connects an image to another image's service under an alias.
+type Link struct {
+	Service string `yaml:"service,omitempty"`
+	Alias   string `yaml:"alias,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// An Environment is a single environment variable for an image.
+type Environment struct {
+	Variable    string `yaml:"variable,omitempty"`
+	Value       string `yaml:"value,omitempty"`
+	Description string `yaml:"description,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// A Port maps a port on the host to one in an image's container.
+type Port struct {
+	HostPort      IntOrString `yaml:"host_port,omitempty"`
+	ContainerPort IntOrString `yaml:"container_port,omitempty"`
+	Protocol      string      `yaml:"proto,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// A Volume mounts a path on the host in an image's container.
+type Volume struct {
+	HostPath      string `yaml:"host_path,omitempty"`
+	ContainerPath string `yaml:"container_path,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// IntOrString is a number that templates may write either as an integer or
+// as a string. It is always written back out as an integer. An empty string
+// is 0, as the agent reads it.
+type IntOrString int
+
+// UnmarshalYAML implements the yaml.Unmarshaler interface.
+func (i *IntOrString) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var n int
+	if err := unmarshal(&n); err == nil {
+		*i = IntOrString(n)
+		return nil
+	}
+
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return i.UnmarshalText([]byte(s))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. The YAML
+// decoder uses it instead of UnmarshalYAML for empty strings.
+func (i *IntOrString) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		*i = 0
+		return nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("'%s' is not a number", b)
+	}
+	*i = IntOrString(n)
+	return nil
+}
+
+// Parse reads a template from YAML.
+func Parse(b []byte) (Template, error) {
+	var t Template
+	err := yaml.Unmarshal(b, &t)
+	return t, err
+}
+
+// Read reads the template at path.
+func Read(path string) (Template, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Template{}, err
+	}
+	return Parse(b)
+}
+
+// Resolve reads the template at path and merges in the images of the
+// templates it includes, and the ones they include in turn. A template that
+// is included more than once is only merged once, but an image name may only
+// be used by one of them, and a template may not include itself.
+func Resolve(path string) (Template, error) {
+	r := resolver{origins: make(map[string]string), done: make(map[string]bool)}
+	t, err := r.read(path)
+	if err != nil {
+		return Template{}, err
+	}
+	t.Include = nil
+	return t, nil
+}
+
+type resolver struct {
+	// stack is the chain of templates being included, to detect cycles.
+	stack []string
+	// origins is the template that each image came from.
+	origins map[string]string
+	done    map[string]bool
+}
+
+func (r *resolver) read(path string) (Template, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Template{}, err
+	}
+	for i, p := range r.stack {
+		if p == abs {
+			chain := append(append([]string{}, r.stack[i:]...), abs)
+			return Template{}, fmt.Errorf("'%s' includes itself: %s", path, strings.Join(chain, " -> "))
+		}
+	}
+	if r.done[abs] {
+		return Template{}, nil
+	}
+
+	t, err := Read(path)
+	if err != nil {
+		return Template{}, err
+	}
+	for _, i := range t.Images {
+		if origin, ok := r.origins[i.Name]; ok {
+			return Template{}, fmt.Errorf("image '%s' is in both '%s' and '%s'", i.Name, origin, path)
+		}
+		r.origins[i.Name] = path
+	}
+
+	r.stack = append(r.stack, abs)
+	for _, inc := range t.Include {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		included, err := r.read(inc)
+		if err != nil {
+			return Template{}, err
+		}
+		t.Images = append(t.Images, included.Images...)
+	}
+	r.stack = r.stack[:len(r.stack)-1]
+	r.done[abs] = true
+
+	return t, nil
+}
+
+// Marshal writes the template as YAML, with its known fields in the order
+// they're declared in followed by any others in alphabetical order.
+func (t Template) Marshal() ([]byte, error) {
+	return yaml.Marshal(t)
+}
+
+// IsRecommended is true when the template is marked as recommended.
+func (t Template) IsRecommended() bool {
+	return t.Recommended != nil && *t.Recommended
+}
+
+// KeywordList splits the template's comma-separated keywords.
+func (t Template) KeywordList() []string {
+	var keywords []string
+	for _, k := range strings.Split(t.Keywords, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+// AgentTemplate converts the template to the agent's model, which holds only
+// what is needed to deploy it.
+func (t Template) AgentTemplate() agent.Template {
+	at := agent.Template{Name: t.Name}
+	for _, i := range t.Images {
+		at.Images = append(at.Images, i.agentImage())
+	}
+	return at
+}
+
+func (i Image) agentImage() agent.Image {
+	ai := agent.Image{
+		Name:        i.Name,
+		Source:      i.Source,
+		Command:     i.Command,
+		VolumesFrom: i.VolumesFrom,
+	}
+	if i.Deployment != nil {
+		ai.Deployment.Count = agent.FromIntOrString{Value: int(i.Deployment.Count)}
+	}
+	for _, l := range i.Links {
+		ai.Links = append(ai.Links, agent.Link{Service: l.Service, Alias: l.Alias})
+	}
+	for _, e := range i.Environment {
+		ai.Environment = append(ai.Environment, agent.Environment{Variable: e.Variable, Value: e.Value})
+	}
+	for _, p := range i.Ports {
+		ai.Ports = append(ai.Ports, agent.Port{
+			HostPort:      agent.FromIntOrString{Value: int(p.HostPort)},
+			ContainerPort: agent.FromIntOrString{Value: int(p.ContainerPort)},
+		})
+	}
+	for _, e := range i.Expose {
+		ai.Expose = append(ai.Expose, agent.FromIntOrString{Value: int(e)})
+	}
+	for _, v := range i.Volumes {
+		ai.Volumes = append(ai.Volumes, agent.Volume{HostPath: v.HostPath, ContainerPath: v.ContainerPath})
+	}
+	return ai
+}
@@ -0,0 +1,199 @@
+package template
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CenturyLinkLabs/panamax-remote-agent-go/agent"
+	"github.com/stretchr/testify/assert"
+)
+
+var wordpressTemplate = `name: Wordpress with MySQL
+description: Wordpress container linked to a MySQL container
+keywords: wordpress, mysql, public
+type: wordpress
+recommended: true
+documentation: |
+  Wordpress with MySQL
+  ====================
+  The alias for the link needs to be DB_1.
+authors:
+- ctl-labs-futuretech@savvis.com
+images:
+- name: WP
+  source: centurylink/wordpress:3.9.1
+  description: Wordpress
+  category: Web Tier
+  type: wordpress
+  deployment:
+    count: 2
+  links:
+  - service: DB
+    alias: DB_1
+  environment:
+  - variable: DB_PASSWORD
+    value: pass@word01
+    description: Must match MYSQL_ROOT_PASSWORD
+  ports:
+  - host_port: 8080
+    container_port: 80
+    proto: TCP
+  expose:
+  - 80
+  volumes_from:
+  - DB
+  min_cpu: 2
+- name: DB
+  source: centurylink/mysql:5.5
+  volumes:
+  - host_path: /data
+    container_path: /var/lib/mysql
+source:
+  id: 12
+  repo: public
+`
+
+func TestParse(t *testing.T) {
+	tpl, err := Parse([]byte(wordpressTemplate))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Wordpress with MySQL", tpl.Name)
+	assert.True(t, tpl.IsRecommended())
+	assert.Equal(t, []string{"wordpress", "mysql", "public"}, tpl.KeywordList())
+	assert.Equal(t, []string{"ctl-labs-futuretech@savvis.com"}, tpl.Authors)
+	assert.Contains(t, tpl.Documentation, "needs to be DB_1.\n")
+	assert.NotNil(t, tpl.Extra["source"])
+	if assert.Len(t, tpl.Images, 2) {
+		wp := tpl.Images[0]
+		assert.Equal(t, "Web Tier", wp.Category)
+		assert.Equal(t, IntOrString(2), wp.Deployment.Count)
+		assert.Equal(t, "Must match MYSQL_ROOT_PASSWORD", wp.Environment[0].Description)
+		assert.Equal(t, "TCP", wp.Ports[0].Protocol)
+		assert.Equal(t, []string{"DB"}, wp.VolumesFrom)
+		assert.Equal(t, 2, wp.Extra["min_cpu"])
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	tpl, err := Parse([]byte(wordpressTemplate))
+	assert.NoError(t, err)
+
+	b, err := tpl.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, wordpressTemplate, string(b))
+}
+
+func TestParseIntOrString(t *testing.T) {
+	tpl, err := Parse([]byte("images:\n- name: a\n  deployment:\n    count: \"3\"\n  ports:\n  - host_port: '80'\n    container_port: 80\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, IntOrString(3), tpl.Images[0].Deployment.Count)
+	assert.Equal(t, IntOrString(80), tpl.Images[0].Ports[0].HostPort)
+
+	tpl, err = Parse([]byte("images:\n- name: a\n  deployment:\n    count: \"\"\n  ports:\n  - host_port: \"\"\n    container_port: ' '\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, IntOrString(0), tpl.Images[0].Deployment.Count)
+	assert.Equal(t, IntOrString(0), tpl.Images[0].Ports[0].HostPort)
+	assert.Equal(t, IntOrString(0), tpl.Images[0].Ports[0].ContainerPort)
+
+	_, err = Parse([]byte("images:\n- name: a\n  expose:\n  - eighty\n"))
+	assert.EqualError(t, err, "'eighty' is not a number")
+}
+
+func TestNotRecommended(t *testing.T) {
+	tpl, err := Parse([]byte("name: Test\nrecommended: false\n"))
+	assert.NoError(t, err)
+	assert.False(t, tpl.IsRecommended())
+
+	b, err := tpl.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Test\nrecommended: false\n", string(b))
+	assert.False(t, Template{}.IsRecommended())
+}
+
+func TestAgentTemplate(t *testing.T) {
+	tpl, err := Parse([]byte(wordpressTemplate))
+	assert.NoError(t, err)
+
+	at := tpl.AgentTemplate()
+	assert.Equal(t, "Wordpress with MySQL", at.Name)
+	if assert.Len(t, at.Images, 2) {
+		assert.Equal(t, agent.Image{
+			Name:        "WP",
+			Source:      "centurylink/wordpress:3.9.1",
+			Deployment:  agent.DeploymentSettings{Count: agent.FromIntOrString{Value: 2}},
+			Links:       []agent.Link{{Service: "DB", Alias: "DB_1"}},
+			Environment: []agent.Environment{{Variable: "DB_PASSWORD", Value: "pass@word01"}},
+			Ports:       []agent.Port{{HostPort: agent.FromIntOrString{Value: 8080}, ContainerPort: agent.FromIntOrString{Value: 80}}},
+			Expose:      []agent.FromIntOrString{{Value: 80}},
+			VolumesFrom: []string{"DB"},
+		}, at.Images[0])
+		assert.Equal(t, []agent.Volume{{HostPath: "/data", ContainerPath: "/var/lib/mysql"}}, at.Images[1].Volumes)
+	}
+}
+
+func TestRead(t *testing.T) {
+	f, err := ioutil.TempFile("", "template.pmx")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("name: Test\n")
+	f.Close()
+
+	tpl, err := Read(f.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "Test", tpl.Name)
+
+	_, err = Read("/nonexistant.pmx")
+	assert.Error(t, err)
+}
+
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "pmx-include")
+	assert.NoError(t, err)
+	os.Mkdir(filepath.Join(dir, "common"), 0700)
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestResolve(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"stack.pmx":        "name: Stack\ninclude:\n- common/mysql.pmx\n- common/redis.pmx\nimages:\n- name: web\n  source: nginx\n",
+		"common/mysql.pmx": "name: MySQL\ninclude:\n- redis.pmx\nimages:\n- name: mysql\n  source: mysql:5.5\n",
+		"common/redis.pmx": "name: Redis\nimages:\n- name: redis\n  source: redis:3\n",
+	})
+	defer os.RemoveAll(dir)
+
+	tpl, err := Resolve(filepath.Join(dir, "stack.pmx"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Stack", tpl.Name)
+	assert.Nil(t, tpl.Include)
+	var names []string
+	for _, i := range tpl.Images {
+		names = append(names, i.Name)
+	}
+	assert.Equal(t, []string{"web", "mysql", "redis"}, names)
+}
+
+func TestErroredResolve(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"conflict.pmx": "include:\n- other.pmx\nimages:\n- name: db\n",
+		"other.pmx":    "images:\n- name: db\n",
+		"a.pmx":        "include:\n- b.pmx\n",
+		"b.pmx":        "include:\n- a.pmx\n",
+		"missing.pmx":  "include:\n- nonexistant.pmx\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := Resolve(filepath.Join(dir, "conflict.pmx"))
+	assert.EqualError(t, err, "image 'db' is in both '"+filepath.Join(dir, "conflict.pmx")+"' and '"+filepath.Join(dir, "other.pmx")+"'")
+
+	_, err = Resolve(filepath.Join(dir, "a.pmx"))
+	assert.Contains(t, err.Error(), "includes itself: ")
+	assert.Contains(t, err.Error(), "a.pmx -> "+filepath.Join(dir, "b.pmx")+" -> ")
+
+	_, err = Resolve(filepath.Join(dir, "missing.pmx"))
+	assert.Error(t, err)
+}